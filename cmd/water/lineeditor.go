@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// Read lines from a terminal, with the basic editing keys and
+// a history of the previous lines.
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      uintptr
+	history []string
+}
+
+func newLineEditor(in io.Reader, out io.Writer, fd uintptr) *lineEditor {
+	return &lineEditor{
+		in:  bufio.NewReader(in),
+		out: out,
+		fd:  fd,
+	}
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+}
+
+// Read a line without the newline character. It returns io.EOF when
+// the input is closed and errInterrupted if the line is discarded.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		// Read plain lines if the terminal can't be configured
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	return e.edit(prompt)
+}
+
+// Edit a line with the keys read from a terminal in raw mode.
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	cursor := 0
+
+	// Position in the history and the line being written before
+	// starting to browse it
+	current := len(e.history)
+	saved := ""
+
+	for {
+		e.refresh(prompt, buf, cursor)
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if cursor < len(buf) {
+				buf = append(buf[:cursor], buf[cursor+1:]...)
+			}
+
+		case 127, 8: // Backspace
+			if cursor > 0 {
+				buf = append(buf[:cursor-1], buf[cursor:]...)
+				cursor--
+			}
+
+		case 1: // Ctrl-A
+			cursor = 0
+
+		case 5: // Ctrl-E
+			cursor = len(buf)
+
+		case 11: // Ctrl-K
+			buf = buf[:cursor]
+
+		case 21: // Ctrl-U
+			buf = buf[cursor:]
+			cursor = 0
+
+		case 27: // Escape sequences of the special keys
+			if next, _, _ := e.in.ReadRune(); next != '[' && next != 'O' {
+				continue
+			}
+
+			key, _, _ := e.in.ReadRune()
+			switch key {
+			case 'A': // Up
+				if current > 0 {
+					if current == len(e.history) {
+						saved = string(buf)
+					}
+					current--
+					buf = []rune(e.history[current])
+					cursor = len(buf)
+				}
+
+			case 'B': // Down
+				if current < len(e.history) {
+					current++
+					if current == len(e.history) {
+						buf = []rune(saved)
+					} else {
+						buf = []rune(e.history[current])
+					}
+					cursor = len(buf)
+				}
+
+			case 'C': // Right
+				if cursor < len(buf) {
+					cursor++
+				}
+
+			case 'D': // Left
+				if cursor > 0 {
+					cursor--
+				}
+
+			case 'H': // Home
+				cursor = 0
+
+			case 'F': // End
+				cursor = len(buf)
+
+			case '3': // Delete, followed by a ~
+				e.in.ReadRune()
+				if cursor < len(buf) {
+					buf = append(buf[:cursor], buf[cursor+1:]...)
+				}
+			}
+
+		default:
+			if r >= ' ' {
+				buf = append(buf[:cursor], append([]rune{r}, buf[cursor:]...)...)
+				cursor++
+			}
+		}
+	}
+}
+
+// Redraw the line, placing the terminal cursor in its position.
+func (e *lineEditor) refresh(prompt string, buf []rune, cursor int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+	if n := len(buf) - cursor; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	keyUp     = "\x1b[A"
+	keyDown   = "\x1b[B"
+	keyRight  = "\x1b[C"
+	keyLeft   = "\x1b[D"
+	keyHome   = "\x1b[H"
+	keyEnd    = "\x1b[F"
+	keyDelete = "\x1b[3~"
+)
+
+func TestEditKeys(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"plain text", "abc\r", "abc"},
+		{"newline", "abc\n", "abc"},
+		{"unicode", "λx\r", "λx"},
+		{"backspace", "abd\x7fc\r", "abc"},
+		{"backspace at the start", "\x7f\x08ab\r", "ab"},
+		{"insert in the middle", "ac" + keyLeft + "b\r", "abc"},
+		{"move right", "ac" + keyLeft + keyLeft + keyRight + "b\r", "abc"},
+		{"home and end", "bc" + keyHome + "a" + keyEnd + "d\r", "abcd"},
+		{"ctrl-a and ctrl-e", "bc\x01a\x05d\r", "abcd"},
+		{"ctrl-k", "abcd" + keyLeft + keyLeft + "\x0b\r", "ab"},
+		{"ctrl-u", "abcd" + keyLeft + "\x15\r", "d"},
+		{"delete", "abc" + keyHome + keyDelete + "\r", "bc"},
+		{"ctrl-d deletes", "abc" + keyHome + "\x04\r", "bc"},
+		{"control characters", "a\x02\x07b\r", "ab"},
+		{"unknown escape", "a\x1bxb\r", "ab"},
+	}
+
+	for _, test := range tests {
+		e := newLineEditor(strings.NewReader(test.input), io.Discard, 0)
+		line, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if line != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, line, test.want)
+		}
+	}
+}
+
+func TestEditHistory(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"previous line", keyUp + "\r", "second"},
+		{"first line", keyUp + keyUp + keyUp + "\r", "first"},
+		{"edit a line", keyUp + "!\r", "second!"},
+		{"back to the new line", "new" + keyUp + keyUp + keyDown + keyDown + "\r", "new"},
+		{"after the last line", keyDown + "x\r", "x"},
+	}
+
+	for _, test := range tests {
+		e := newLineEditor(strings.NewReader(test.input), io.Discard, 0)
+		e.addHistory("first")
+		e.addHistory("second")
+
+		line, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if line != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, line, test.want)
+		}
+	}
+}
+
+func TestEditInterrupts(t *testing.T) {
+	tests := []struct {
+		name, input string
+		want        error
+	}{
+		{"ctrl-c", "abc\x03", errInterrupted},
+		{"ctrl-d in an empty line", "\x04", io.EOF},
+		{"closed input", "abc", io.EOF},
+	}
+
+	for _, test := range tests {
+		e := newLineEditor(strings.NewReader(test.input), io.Discard, 0)
+		if _, err := e.edit("> "); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	e := newLineEditor(strings.NewReader(""), io.Discard, 0)
+	for _, line := range []string{"a", "", "  ", "a", "b", "a"} {
+		e.addHistory(line)
+	}
+
+	want := []string{"a", "b", "a"}
+	if strings.Join(e.history, ",") != strings.Join(want, ",") {
+		t.Errorf("got %q, want %q", e.history, want)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	var out bytes.Buffer
+	e := newLineEditor(strings.NewReader(""), &out, 0)
+	e.refresh("> ", []rune("abcd"), 1)
+
+	if got, want := out.String(), "\r> abcd\x1b[K\x1b[3D"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Without a terminal the lines are read as they come.
+func TestReadPlainLines(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	var out bytes.Buffer
+	e := newLineEditor(strings.NewReader("first\r\nsecond"), &out, r.Fd())
+	for _, want := range []string{"first", "second"} {
+		line, err := e.readLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+
+	if _, err := e.readLine("> "); err != io.EOF {
+		t.Errorf("got %v at the end of the input, want EOF", err)
+	}
+	if got := out.String(); got != "> > > " {
+		t.Errorf("got %q as the output, want only the prompts", got)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ernestokarim/water"
+)
+
+var useVM = flag.Bool("vm", false, "compile the code to bytecode and run it in a virtual machine")
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Println("ERROR:", err)
+	}
+}
+
+func run() error {
+	// The source stream
+	var f io.ReadCloser
+	name := "<stdin>"
+
+	if flag.Arg(0) != "" {
+		// Open the file if it's the first arg
+		name = flag.Arg(0)
+
+		var err error
+		f, err = os.Open(flag.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	} else if isTerminal(os.Stdin.Fd()) {
+		// Start an interactive session if there's no filename and
+		// the code is going to be typed
+		return repl(newInterpreter())
+	} else {
+		// Use stdin if there's no filename in the args
+		f = os.Stdin
+	}
+
+	// Parse it
+	root, err := water.Parse(name, f)
+	if err != nil {
+		return err
+	}
+
+	// Exec it
+	if err := newInterpreter().Exec(os.Stdout, root); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func newInterpreter() *water.Interpreter {
+	interp := water.NewInterpreter()
+	if *useVM {
+		interp.SetBackend(water.BytecodeVM)
+	}
+	return interp
+}
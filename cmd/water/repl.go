@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ernestokarim/water"
+)
+
+const (
+	historyFile = ".water_history"
+	historySize = 1000
+)
+
+// Run an interactive session reading the code from the terminal. The
+// environment is kept between the lines, and the errors are reported
+// without ending the session.
+func repl(interp *water.Interpreter) error {
+	e := newLineEditor(os.Stdin, os.Stdout, os.Stdin.Fd())
+	out := &lineWriter{w: os.Stdout}
+	if home, err := os.UserHomeDir(); err == nil {
+		path := filepath.Join(home, historyFile)
+		loadHistory(e, path)
+		defer saveHistory(e, path)
+	}
+
+	src := ""
+	for {
+		prompt := "water> "
+		if src != "" {
+			prompt = "  ...> "
+		}
+
+		line, err := e.readLine(prompt)
+		if err == errInterrupted {
+			src = ""
+			continue
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		e.addHistory(line)
+
+		// Wait for the rest of the lines if the expression is not complete
+		src += line + "\n"
+		if strings.TrimSpace(src) == "" {
+			src = ""
+			continue
+		}
+		if water.Incomplete(src) {
+			continue
+		}
+
+		root, err := interp.Parse("<repl>", strings.NewReader(src))
+		src = ""
+		if err == nil {
+			err = interp.Exec(out, root)
+		}
+
+		// The prompt redraws its line, so it cannot share it with
+		// the output that doesn't end in a newline
+		if out.midLine {
+			fmt.Println()
+			out.midLine = false
+		}
+		if err != nil {
+			fmt.Println("ERROR:", err)
+		}
+	}
+}
+
+// Record if the output written ends in the middle of a line.
+type lineWriter struct {
+	w       io.Writer
+	midLine bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.midLine = p[len(p)-1] != '\n'
+	}
+	return w.w.Write(p)
+}
+
+func loadHistory(e *lineEditor, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e.addHistory(scanner.Text())
+	}
+}
+
+func saveHistory(e *lineEditor, path string) {
+	lines := e.history
+	if len(lines) > historySize {
+		lines = lines[len(lines)-historySize:]
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	for _, line := range lines {
+		fmt.Fprintln(f, line)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"syscall"
+)
+
+const (
+	ioctlReadTermios  = syscall.TCGETS
+	ioctlWriteTermios = syscall.TCSETS
+)
@@ -0,0 +1,576 @@
+package water
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type opcode uint8
+
+const (
+	opConst        opcode = iota // push the constant A
+	opPop                        // discard the top of the stack
+	opLocal                      // push the local variable A
+	opSetLocal                   // assign the top of the stack to the local variable A
+	opDefineLocal                // define the local variable A with the top of the stack
+	opUnbound                    // push if the local variable A is not defined yet
+	opGlobal                     // push the global variable named A
+	opSetGlobal                  // assign the top of the stack to the global variable named A
+	opDefineGlobal               // define the global variable named A with the top of the stack
+	opJump                       // jump to the instruction A
+	opJumpFalse                  // pop the test and jump to the instruction A if it's false
+	opClosure                    // push a closure of the function A
+	opCall                       // call a function with A arguments
+	opTailCall                   // call a function with A arguments replacing the current one
+	opReturn                     // return the top of the stack
+	opEnter                      // create the environment of the let A with the values in the stack
+	opLeave                      // go back to the environment that encloses the current one
+	opAnd                        // jump to the instruction A if the top of the stack is false, or pop it
+	opOr                         // jump to the instruction A if the top of the stack is true, or pop it
+	opMemv                       // push if the top of the stack is in the list of the constant A
+	opLoop                       // save the state to restore when a break exits the loop
+	opEndLoop                    // discard the state saved by the innermost loop
+	opBreak                      // exit the innermost loop with the top of the stack and jump to A
+	opDotimes                    // jump to A if the counter below the count is finished, or push it and increment it
+)
+
+// Instructions are encoded with the opcode in the lower 8 bits and the
+// operand in the upper 24 bits. Local variables are addressed with the
+// number of environments to go up in the high 8 bits of the operand
+// and the index of the variable in the low 16 bits.
+type instr uint32
+
+const (
+	maxOperand = 1<<24 - 1
+	maxDepth   = 1<<8 - 1
+	maxSlots   = 1<<16 - 1
+)
+
+func (i instr) op() opcode {
+	return opcode(i & 0xff)
+}
+
+func (i instr) arg() int {
+	return int(i >> 8)
+}
+
+// ========================================================
+
+// A compiled function, or a top-level expression.
+type proto struct {
+	arity  arity
+	params int      // number of arguments, without the rest one
+	rest   bool     // the extra arguments are collected in the slot after them
+	slots  []string // names of the local variables, the arguments first
+	code   []instr
+	pos    []Pos // position of each instruction, for the errors
+	consts []Value
+	names  []string  // names of the global variables
+	protos []*proto  // functions defined inside this one
+	lets   []*letEnv // environments of the lets inside this function
+}
+
+func (p *proto) String() string {
+	return fmt.Sprintf("function with arity %s and %d instructions", p.arity, len(p.code))
+}
+
+// Environment of a let inside a function.
+type letEnv struct {
+	names  []string
+	values int // number of values in the stack that initialize the variables
+}
+
+// Local variables of a function or a let, in the order of the slots of
+// their environment at runtime.
+type locals struct {
+	names []string
+	outer *locals
+}
+
+// ========================================================
+
+// Compile a top-level expression to bytecode.
+func compile(n Node) (p *proto, err error) {
+	c := &compiler{proto: new(proto)}
+	defer c.recover(&err)
+
+	c.compile(n, true)
+	c.emit(n, opReturn, 0)
+
+	return c.proto, nil
+}
+
+type compiler struct {
+	proto  *proto
+	locals *locals // nil outside of the functions and the lets
+	breaks [][]int // jumps of the breaks of each loop, to patch them at its end
+}
+
+func (c *compiler) errorf(n Node, format string, args ...interface{}) {
+	panic(&ParseError{Pos: n.Position(), Msg: fmt.Sprintf(format, args...)})
+}
+
+func (c *compiler) recover(errp *error) {
+	if e := recover(); e != nil {
+		if _, ok := e.(runtime.Error); ok {
+			panic(e)
+		}
+		*errp = e.(*ParseError)
+	}
+}
+
+// Append an instruction, returning its index.
+func (c *compiler) emit(n Node, op opcode, arg int) int {
+	if arg > maxOperand {
+		c.errorf(n, "function too large to be compiled")
+	}
+
+	c.proto.code = append(c.proto.code, instr(uint32(arg)<<8|uint32(op)))
+	c.proto.pos = append(c.proto.pos, n.Position())
+	return len(c.proto.code) - 1
+}
+
+// Change the target of a jump to the next instruction.
+func (c *compiler) patch(n Node, jump int) {
+	target := len(c.proto.code)
+	if target > maxOperand {
+		c.errorf(n, "function too large to be compiled")
+	}
+
+	op := c.proto.code[jump].op()
+	c.proto.code[jump] = instr(uint32(target)<<8 | uint32(op))
+}
+
+func (c *compiler) emitConst(n Node, v Value) {
+	c.proto.consts = append(c.proto.consts, v)
+	c.emit(n, opConst, len(c.proto.consts)-1)
+}
+
+func (c *compiler) global(name string) int {
+	for i, global := range c.proto.names {
+		if global == name {
+			return i
+		}
+	}
+
+	c.proto.names = append(c.proto.names, name)
+	return len(c.proto.names) - 1
+}
+
+// Return the address of a local variable, or false if it's global.
+func (c *compiler) resolve(n Node, name string) (int, bool) {
+	depth := 0
+	for l := c.locals; l != nil; l = l.outer {
+		for i, slot := range l.names {
+			if slot == name {
+				if depth > maxDepth {
+					c.errorf(n, "too many nested functions")
+				}
+				return depth<<16 | i, true
+			}
+		}
+		depth++
+	}
+	return 0, false
+}
+
+// Compile an expression that leaves its value in the stack. Calls in tail
+// position replace the current function instead of returning to it.
+func (c *compiler) compile(n Node, tail bool) {
+	switch n := n.(type) {
+	case *NumberNode, *StringNode, *BoolNode:
+		c.emitConst(n, datumValue(n))
+
+	case *QuoteNode:
+		c.emitConst(n, n.datum())
+
+	case *VarNode:
+		if addr, ok := c.resolve(n, n.Name); ok {
+			c.emit(n, opLocal, addr)
+		} else {
+			c.emit(n, opGlobal, c.global(n.Name))
+		}
+
+	case *DefineNode:
+		c.compile(n.Value, false)
+		if c.locals == nil {
+			c.emit(n, opDefineGlobal, c.global(n.Variable.Name))
+		} else {
+			addr, _ := c.resolve(n, n.Variable.Name)
+			c.emit(n, opDefineLocal, addr)
+		}
+
+	case *SetNode:
+		c.compile(n.Value, false)
+		if addr, ok := c.resolve(n, n.Variable.Name); ok {
+			c.emit(n, opSetLocal, addr)
+		} else {
+			c.emit(n, opSetGlobal, c.global(n.Variable.Name))
+		}
+
+	case *IfNode:
+		c.compile(n.Test, false)
+		jumpAlt := c.emit(n.Test, opJumpFalse, 0)
+		c.compileBranch(n, n.Conseq, tail)
+		jumpEnd := c.emit(n, opJump, 0)
+		c.patch(n, jumpAlt)
+		c.compileBranch(n, n.Alt, tail)
+		c.patch(n, jumpEnd)
+
+	case *AndNode:
+		c.compileLogic(n, n.Nodes, opAnd, Bool(true), tail)
+
+	case *OrNode:
+		c.compileLogic(n, n.Nodes, opOr, Bool(false), tail)
+
+	case *CaseNode:
+		c.compileCase(n, tail)
+
+	case *DoNode:
+		c.compileDo(n)
+
+	case *WhileNode:
+		c.compileWhile(n)
+
+	case *DotimesNode:
+		c.compileDotimes(n)
+
+	case *BreakNode:
+		c.compileBranch(n, n.Value, false)
+		loop := len(c.breaks) - 1
+		c.breaks[loop] = append(c.breaks[loop], c.emit(n, opBreak, 0))
+
+	case *BeginNode:
+		last := len(n.Nodes) - 1
+		for _, node := range n.Nodes[:last] {
+			c.compile(node, false)
+			c.emit(node, opPop, 0)
+		}
+		c.compile(n.Nodes[last], tail)
+
+	case *LambdaNode:
+		c.proto.protos = append(c.proto.protos, c.compileLambda(n))
+		c.emit(n, opClosure, len(c.proto.protos)-1)
+
+	case *LetNode:
+		c.compileLet(n, tail)
+
+	case *CallNode:
+		c.compile(n.Callee, false)
+		for _, arg := range n.Args {
+			c.compile(arg, false)
+		}
+		if tail {
+			c.emit(n, opTailCall, len(n.Args))
+		} else {
+			c.emit(n, opCall, len(n.Args))
+		}
+
+	default:
+		c.errorf(n, "cannot compile the node: %s", n)
+	}
+}
+
+// Compile a branch of an if or a case, that can be nil if it
+// doesn't have any value.
+func (c *compiler) compileBranch(n Node, branch Node, tail bool) {
+	if branch == nil {
+		c.emitConst(n, Nil{})
+		return
+	}
+	c.compile(branch, tail)
+}
+
+// Compile the expressions of an and/or, jumping to the end with the
+// value of the first one that decides the result.
+func (c *compiler) compileLogic(n Node, nodes []Node, op opcode, empty Value, tail bool) {
+	if len(nodes) == 0 {
+		c.emitConst(n, empty)
+		return
+	}
+
+	last := len(nodes) - 1
+	jumps := make([]int, 0, last)
+	for _, node := range nodes[:last] {
+		c.compile(node, false)
+		jumps = append(jumps, c.emit(node, op, 0))
+	}
+	c.compile(nodes[last], tail)
+
+	for _, jump := range jumps {
+		c.patch(n, jump)
+	}
+}
+
+// The key of a case stays in the stack while the clauses are tested,
+// and it's discarded before executing the body of the selected one.
+func (c *compiler) compileCase(n *CaseNode, tail bool) {
+	c.compile(n.Key, false)
+
+	jumps := make([]int, 0, len(n.Clauses))
+	for _, clause := range n.Clauses {
+		datums := make([]Value, len(clause.Datums))
+		for i, d := range clause.Datums {
+			datums[i] = datumValue(d)
+		}
+		c.proto.consts = append(c.proto.consts, list(datums...))
+		c.emit(n, opMemv, len(c.proto.consts)-1)
+
+		next := c.emit(n, opJumpFalse, 0)
+		c.emit(n, opPop, 0)
+		c.compile(clause.Body, tail)
+		jumps = append(jumps, c.emit(n, opJump, 0))
+		c.patch(n, next)
+	}
+
+	c.emit(n, opPop, 0)
+	c.compileBranch(n, n.Else, tail)
+
+	for _, jump := range jumps {
+		c.patch(n, jump)
+	}
+}
+
+// Loops save the height of the stack and the environment when they start,
+// to restore them if a break exits the loop in the middle of an expression.
+func (c *compiler) beginLoop(n Node) {
+	c.emit(n, opLoop, 0)
+	c.breaks = append(c.breaks, nil)
+}
+
+// Finish the code of a loop, where its breaks jump to with the value.
+func (c *compiler) endLoop(n Node) {
+	loop := len(c.breaks) - 1
+	for _, jump := range c.breaks[loop] {
+		c.patch(n, jump)
+	}
+	c.breaks = c.breaks[:loop]
+}
+
+// Create a new environment for the variables of a loop, returning the
+// index of the let that describes it.
+func (c *compiler) loopEnv(n Node, vars []Node, values int, defines []string) int {
+	c.locals = &locals{outer: c.locals}
+	for _, v := range vars {
+		c.locals.names = append(c.locals.names, v.(*VarNode).Name)
+	}
+	c.reserveDefines(defines)
+	if len(c.locals.names) > maxSlots {
+		c.errorf(n, "too many local variables")
+	}
+
+	c.proto.lets = append(c.proto.lets, &letEnv{names: c.locals.names, values: values})
+	return len(c.proto.lets) - 1
+}
+
+// Each iteration of a do enters a new environment with the values of
+// the variables in the stack.
+func (c *compiler) compileDo(n *DoNode) {
+	c.beginLoop(n)
+	for _, init := range n.Inits {
+		c.compile(init, false)
+	}
+
+	outer := c.locals
+	env := c.loopEnv(n, n.Vars, len(n.Vars), n.bodyDefines())
+
+	start := c.emit(n, opEnter, env)
+	c.compile(n.Test, false)
+	jumpBody := c.emit(n.Test, opJumpFalse, 0)
+
+	c.compileBranch(n, n.Result, false)
+	c.emit(n, opLeave, 0)
+	c.emit(n, opEndLoop, 0)
+	jumpEnd := c.emit(n, opJump, 0)
+
+	c.patch(n, jumpBody)
+	if n.Body != nil {
+		c.compile(n.Body, false)
+		c.emit(n, opPop, 0)
+	}
+
+	// Variables without step keep their current value
+	for i, step := range n.Steps {
+		if step == nil {
+			step = n.Vars[i]
+		}
+		c.compile(step, false)
+	}
+	c.emit(n, opLeave, 0)
+	c.emit(n, opJump, start)
+
+	c.locals = outer
+	c.patch(n, jumpEnd)
+	c.endLoop(n)
+}
+
+// The test of a while is evaluated in the outer environment, and each
+// iteration of the body enters a new one.
+func (c *compiler) compileWhile(n *WhileNode) {
+	c.beginLoop(n)
+
+	start := len(c.proto.code)
+	c.compile(n.Test, false)
+	jumpEnd := c.emit(n.Test, opJumpFalse, 0)
+	if n.Body != nil {
+		outer := c.locals
+		env := c.loopEnv(n, nil, 0, n.bodyDefines())
+		c.emit(n, opEnter, env)
+		c.compile(n.Body, false)
+		c.emit(n, opPop, 0)
+		c.emit(n, opLeave, 0)
+		c.locals = outer
+	}
+	c.emit(n, opJump, start)
+
+	c.patch(n, jumpEnd)
+	c.emit(n, opEndLoop, 0)
+	c.emitConst(n, Nil{})
+	c.endLoop(n)
+}
+
+// The count and the counter of a dotimes stay in the stack during the loop.
+func (c *compiler) compileDotimes(n *DotimesNode) {
+	c.beginLoop(n)
+	c.compile(n.Count, false)
+	c.emitConst(n, Int(0))
+
+	outer := c.locals
+	env := c.loopEnv(n, []Node{n.Var}, 1, n.bodyDefines())
+
+	start := c.emit(n.Count, opDotimes, 0)
+	if n.Body != nil {
+		c.emit(n, opEnter, env)
+		c.compile(n.Body, false)
+		c.emit(n, opPop, 0)
+		c.emit(n, opLeave, 0)
+	} else {
+		c.emit(n, opPop, 0)
+	}
+	c.emit(n, opJump, start)
+
+	// The result is evaluated with the variable bound to the count
+	c.patch(n, start)
+	c.emit(n, opPop, 0)
+	if n.Result != nil {
+		c.emit(n, opEnter, env)
+		c.compile(n.Result, false)
+		c.emit(n, opLeave, 0)
+	} else {
+		c.emit(n, opPop, 0)
+		c.emitConst(n, Nil{})
+	}
+
+	c.locals = outer
+	c.emit(n, opEndLoop, 0)
+	c.endLoop(n)
+}
+
+func (c *compiler) compileLambda(n *LambdaNode) *proto {
+	fc := &compiler{
+		proto: &proto{
+			arity:  lambdaArity(n),
+			params: len(n.Args),
+			rest:   n.Rest != nil,
+		},
+		locals: &locals{outer: c.locals},
+	}
+	for _, arg := range n.Args {
+		fc.locals.names = append(fc.locals.names, arg.(*VarNode).Name)
+	}
+	if n.Rest != nil {
+		fc.locals.names = append(fc.locals.names, n.Rest.Name)
+	}
+
+	// Reserve the slots of the variables defined inside the function
+	// before compiling it, so they can be referenced before its definition
+	fc.reserveDefines(n.bodyDefines())
+	if len(fc.locals.names) > maxSlots {
+		c.errorf(n, "too many local variables")
+	}
+	fc.proto.slots = fc.locals.names
+
+	// Assign the default values of the optional arguments that
+	// were omitted in the call
+	required := len(n.Args) - n.Optional
+	for i, def := range n.Defaults {
+		arg := n.Args[required+i]
+		fc.emit(arg, opUnbound, required+i)
+		skip := fc.emit(arg, opJumpFalse, 0)
+		if def != nil {
+			fc.compile(def, false)
+		} else {
+			fc.emitConst(arg, Bool(false))
+		}
+		fc.emit(arg, opDefineLocal, required+i)
+		fc.emit(arg, opPop, 0)
+		fc.patch(arg, skip)
+	}
+
+	fc.compile(n.Body, true)
+	fc.emit(n.Body, opReturn, 0)
+
+	return fc.proto
+}
+
+// The variables of a let live in a new environment, that it's created
+// with opEnter and left with opLeave, unless the body is in tail position
+// and the function returns directly from it.
+func (c *compiler) compileLet(n *LetNode, tail bool) {
+	l := &locals{outer: c.locals}
+	for _, v := range n.Vars {
+		l.names = append(l.names, v.(*VarNode).Name)
+	}
+
+	env := &letEnv{}
+	if !n.Rec {
+		for _, value := range n.Values {
+			c.compile(value, false)
+		}
+		env.values = len(n.Values)
+	}
+
+	outer := c.locals
+	c.locals = l
+
+	c.reserveDefines(n.bodyDefines())
+	if len(l.names) > maxSlots {
+		c.errorf(n, "too many local variables")
+	}
+
+	env.names = l.names
+	c.proto.lets = append(c.proto.lets, env)
+	c.emit(n, opEnter, len(c.proto.lets)-1)
+
+	// The values of a letrec are evaluated inside the new environment
+	if n.Rec {
+		for i, value := range n.Values {
+			c.compile(value, false)
+			c.emit(value, opDefineLocal, i)
+			c.emit(value, opPop, 0)
+		}
+	}
+
+	c.compile(n.Body, tail)
+	c.locals = outer
+	if !tail {
+		c.emit(n, opLeave, 0)
+	}
+}
+
+// Reserve the slots of the variables defined in a body, unless they
+// already have one, like the arguments.
+func (c *compiler) reserveDefines(names []string) {
+	for _, name := range names {
+		found := false
+		for _, slot := range c.locals.names {
+			if slot == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.locals.names = append(c.locals.names, name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package water
+
+import (
+	"fmt"
+)
+
+// Error found while parsing the source code.
+type ParseError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return formatError(e.Pos, e.Msg)
+}
+
+// ========================================================
+
+// A call to a user function in the stack of a runtime error.
+type Frame struct {
+	Name string // name of the function, "lambda" if it's anonymous
+	Pos  Pos    // position of the call
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s called at %s", f.Name, f.Pos)
+}
+
+// Error found while executing the code.
+type RuntimeError struct {
+	Pos Pos
+	Msg string
+
+	// Calls that were active when the error happened,
+	// with the innermost one first
+	Stack []Frame
+}
+
+func (e *RuntimeError) Error() string {
+	msg := formatError(e.Pos, e.Msg)
+	for i := 0; i < len(e.Stack); i++ {
+		msg += fmt.Sprintf("\n\tin %s", e.Stack[i])
+
+		// Collapse the frames repeated by a recursion
+		n := 0
+		for i+1 < len(e.Stack) && e.Stack[i+1] == e.Stack[i] {
+			i++
+			n++
+		}
+		if n > 0 {
+			msg += fmt.Sprintf("\n\t... repeated %d more times", n)
+		}
+	}
+	return msg
+}
+
+// ========================================================
+
+// Build an error message prefixed by the position and followed by
+// the source snippet.
+func formatError(pos Pos, msg string) string {
+	if pos.Line == 0 {
+		return msg
+	}
+
+	msg = fmt.Sprintf("%s: %s", pos, msg)
+	if snippet := pos.Snippet(); snippet != "" {
+		msg += "\n" + snippet
+	}
+	return msg
+}
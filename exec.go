@@ -1,114 +1,233 @@
-package main
+package water
 
 import (
 	"fmt"
 	"io"
-	"reflect"
 	"runtime"
 )
 
 type lambdaValue struct {
-	args []string
-	body *CallNode
+	name     string // name of the first variable the lambda was assigned to
+	args     []string
+	defaults []Node   // default values of the optional args at the end of args
+	rest     string   // empty if it doesn't accept extra arguments
+	defines  []string // variables defined in the body
+	arity    arity
+	body     Node
+	env      *state // environment where the lambda was defined
 }
 
 func (v *lambdaValue) String() string {
-	return fmt.Sprintf("<lambda value with arity %d>", len(v.args))
+	return fmt.Sprintf("<lambda value with arity %s>", v.arity)
 }
 
-var (
-	errorType = reflect.TypeOf((*error)(nil)).Elem()
-	zero      reflect.Value
+func (v *lambdaValue) value() {}
 
-	lambdaType = reflect.TypeOf((*lambdaValue)(nil))
-)
+func (v *lambdaValue) procedure() {}
 
-func Exec(output io.Writer, tree *ListNode, funcs map[string]interface{}) (err error) {
-	// Convert the functions to reflect values
-	f := map[string]reflect.Value{}
-	for name, fn := range funcs {
-		f[name] = reflect.ValueOf(fn)
+// Build the global environment, where the builtin functions live.
+func newGlobalState(output io.Writer) *state {
+	return &state{
+		vars:     make(variables),
+		funcs:    make(functions),
+		output:   output,
+		maxDepth: defaultMaxDepth,
 	}
+}
 
-	// Build the environment
-	s := &state{
-		vars:   make(variables),
-		funcs:  f,
-		output: output,
-		t:      tree,
+// Add a Go function to the builtins of the global environment.
+func (s *state) register(name string, fn interface{}) error {
+	b, err := newBuiltin(name, fn)
+	if err != nil {
+		return fmt.Errorf("cannot register %s: %s", name, err)
 	}
 
+	s.funcs[name] = b
+	return nil
+}
+
+// Walk a top-level expression, returning its value.
+func (s *state) walkTop(n Node) (v Value, err error) {
 	// Hook up the recover
 	defer s.recover(&err)
 
-	// Start the execution
-	for _, n := range s.t.Nodes {
-		s.print(s.walkNode(n))
-	}
-
-	return nil
+	return s.walkNode(n), nil
 }
 
 // ========================================================
 
-type variables map[string]reflect.Value
-type functions map[string]reflect.Value
+type variables map[string]Value
+type functions map[string]*builtinValue
 
 type state struct {
 	funcs  functions
 	vars   variables
 	output io.Writer
-	t      *ListNode
 	outer  *state
+	node   Node // current node, for the errors
+
+	// Active calls to user functions and their limit, only in
+	// the global state
+	calls, maxDepth int
 }
 
 func (s *state) recover(errp *error) {
 	if e := recover(); e != nil {
-		*errp = fmt.Errorf("%s", e)
 		if _, ok := e.(runtime.Error); ok {
 			panic(e)
 		}
+
+		if err, ok := e.(*RuntimeError); ok {
+			*errp = err
+		} else {
+			*errp = &RuntimeError{Msg: fmt.Sprint(e)}
+		}
 	}
 }
 
+// Mark the node that it's being executed.
+func (s *state) at(n Node) {
+	s.node = n
+}
+
+// Abort the execution with an error located in the current node.
 func (s *state) errorf(format string, args ...interface{}) {
-	panic(fmt.Sprintf(format, args...))
+	err := &RuntimeError{Msg: fmt.Sprintf(format, args...)}
+	if s.node != nil {
+		err.Pos = s.node.Position()
+	}
+	panic(err)
+}
+
+// Add a frame to the stack of a runtime error that it's being
+// propagated through a call.
+func addFrame(e interface{}, f *lambdaValue, n *CallNode) {
+	if err, ok := e.(*RuntimeError); ok {
+		err.Stack = append(err.Stack, Frame{Name: lambdaName(f.name), Pos: n.Position()})
+	}
+}
+
+// Name of a user function in the errors.
+func lambdaName(name string) string {
+	if name == "" {
+		return "lambda"
+	}
+	return name
 }
 
-func (s *state) print(v reflect.Value) {
-	// Don't print the zero value
-	if v == zero {
+func (s *state) print(v Value) {
+	// Don't print the expressions without value
+	if isNil(v) {
 		return
 	}
 
 	// Strings are printed as they come, without newlines
-	if v.Kind() == reflect.String {
-		fmt.Fprint(s.output, v.Interface())
+	if str, ok := v.(String); ok {
+		fmt.Fprint(s.output, string(str))
 		return
 	}
 
 	// The rest of values are printed with a newline
 	// (in prevention of an object printing)
-	fmt.Fprintln(s.output, v.Interface())
+	fmt.Fprintln(s.output, v)
 }
 
-func (s *state) walkNode(n Node) reflect.Value {
-	switch n := n.(type) {
-	case *CallNode:
-		return s.walkCall(n)
+// Walk a node and return its value. Expressions in tail position (the
+// branches of an if, the last expression of a begin and the body of the
+// called functions) are walked in a loop instead of recursively, so
+// the tail calls don't grow the stack.
+func (s *state) walkNode(n Node) Value {
+	// Last user function called in tail position, to record it
+	// in the stack of the errors
+	var (
+		tail *lambdaValue
+		call *CallNode
+	)
+
+	for {
+		if n == nil {
+			// Branch of an if or a case without any value
+			return Nil{}
+		}
+
+		s.at(n)
+		switch t := n.(type) {
+		case *IfNode:
+			n = s.walkIf(t)
+
+		case *AndNode:
+			v, last := s.walkAnd(t)
+			if last == nil {
+				return v
+			}
+			n = last
+
+		case *OrNode:
+			v, last := s.walkOr(t)
+			if last == nil {
+				return v
+			}
+			n = last
+
+		case *CaseNode:
+			n = s.walkCase(t)
+
+		case *BeginNode:
+			n = s.walkBegin(t)
+
+		case *LetNode:
+			s, n = s.walkLet(t), t.Body
+
+		case *CallNode:
+			f := s.walkCallee(t)
+			if b, ok := f.(*builtinValue); ok {
+				return s.walkBuiltinCall(b, t)
+			}
+
+			// Continue with the body of the function in its new environment
+			lambda, ok := f.(*lambdaValue)
+			if !ok {
+				s.errorf("cannot call a function created by another backend: %s", f)
+			}
+			env := s.newCallState(lambda, t)
+
+			if tail == nil {
+				global := s.global()
+				if global.calls >= global.maxDepth {
+					s.at(t)
+					s.errorf("stack overflow")
+				}
+				global.calls++
+
+				// Errors inside the function record the call
+				defer func() {
+					global.calls--
+					if e := recover(); e != nil {
+						addFrame(e, tail, call)
+						panic(e)
+					}
+				}()
+			}
+			tail, call = lambda, t
+
+			env.fillDefaults(lambda, len(t.Args))
+			s, n = env, lambda.body
+
+		default:
+			return s.walkValue(n)
+		}
+	}
+}
 
+// Walk the nodes that don't contain expressions in tail position.
+func (s *state) walkValue(n Node) Value {
+	switch n := n.(type) {
 	case *DefineNode:
 		return s.walkDefine(n)
 
 	case *SetNode:
 		return s.walkSet(n)
 
-	case *IfNode:
-		return s.walkIf(n)
-
-	case *BeginNode:
-		return s.walkBegin(n)
-
 	case *VarNode:
 		return s.walkVar(n)
 
@@ -123,89 +242,59 @@ func (s *state) walkNode(n Node) reflect.Value {
 
 	case *LambdaNode:
 		return s.walkLambda(n)
-	}
-
-	s.errorf("cannot walk the node: %s", n)
-	panic("not reached")
-}
-
-func (s *state) walkCall(n *CallNode) reflect.Value {
-	// Get the func in the index
-	f, ok := s.evalFunction(n.Name)
-	if !ok {
-		f, ok = s.vars[n.Name]
-		if !ok || f.Type() != lambdaType {
-			s.errorf("function not defined: %s", n.Name)
-		}
 
-		// User-defined funcs are called in a different way
-		return s.walkUserCall(f, n)
-	}
-
-	// Analyze its type
-	t := f.Type()
-	numArgs := t.NumIn()
+	case *QuoteNode:
+		return s.walkQuote(n)
 
-	// Check if the number of args it's correct
-	if t.IsVariadic() {
-		numArgs -= 1
-		if len(n.Args) < numArgs {
-			s.errorf("wrong number of args for %s: want at least %d, got %d", n.Name,
-				numArgs, len(n.Args))
-		}
-	} else if len(n.Args) != numArgs {
-		s.errorf("wrong number of args for %s: want %d, got %d", n.Name, numArgs, len(n.Args))
-	}
+	case *DoNode:
+		return s.walkDo(n)
 
-	// Check if the function return it's correct
-	s.checkFuncReturn(n.Name, t)
+	case *WhileNode:
+		return s.walkWhile(n)
 
-	// Prepare the arguments array
-	nargs := numArgs
-	if t.IsVariadic() {
-		nargs += len(n.Args) - nargs
-	}
-	args := make([]reflect.Value, nargs)
+	case *DotimesNode:
+		return s.walkDotimes(n)
 
-	// Add the fixed arguments
-	i := 0
-	for ; i < numArgs; i++ {
-		args[i] = s.evalArg(t.In(i), n.Args[i])
+	case *BreakNode:
+		s.walkBreak(n)
 	}
 
-	// Add the variadic arguments
-	if t.IsVariadic() {
-		argType := t.In(numArgs).Elem()
-		for ; i < len(n.Args); i++ {
-			args[i] = s.evalArg(argType, n.Args[i])
-		}
-	}
-
-	// Exec the call
-	res := f.Call(args)
+	s.errorf("cannot walk the node: %s", n)
+	panic("not reached")
+}
 
-	// Check if the func has and returned an error
-	if len(res) == 2 && !res[1].IsNil() {
-		s.errorf("error calling %s: %s", n.Name, res[1].Interface().(error))
+// Evaluate the expression in the head of the call, checking that
+// it's a function.
+func (s *state) walkCallee(n *CallNode) Procedure {
+	f := s.walkNode(n.Callee)
+	s.at(n)
+	if isNil(f) {
+		s.errorf("cannot call an expression without value")
 	}
 
-	if t.NumOut() == 0 {
-		return zero
+	if p, ok := f.(Procedure); ok {
+		return p
 	}
 
-	return res[0]
+	s.errorf("cannot call a value that is not a function: %s", formatDatum(f))
+	panic("not reached")
 }
 
-func (s *state) checkFuncReturn(name string, t reflect.Type) {
-	// Check the number of return values
-	if t.NumOut() == 0 || t.NumOut() == 1 || (t.NumOut() == 2 && t.Out(1) == errorType) {
-		return
+func (s *state) walkBuiltinCall(b *builtinValue, n *CallNode) Value {
+	args := make([]Value, len(n.Args))
+	for i, node := range n.Args {
+		args[i] = s.walkNode(node)
 	}
 
-	s.errorf("can't handle multiple returns from function %s", name)
+	s.at(n)
+	v, err := callBuiltin(b, args)
+	if err != nil {
+		s.errorf("%s", err)
+	}
+	return v
 }
 
-func (s *state) evalFunction(name string) (reflect.Value, bool) {
+func (s *state) evalFunction(name string) (Value, bool) {
 	for {
 		if s == nil {
 			break
@@ -220,149 +309,420 @@ func (s *state) evalFunction(name string) (reflect.Value, bool) {
 
 		s = s.outer
 	}
-	return zero, false
+	return nil, false
 }
 
-// Return the correct value for an argument based on its needed argument.
-// It gives the fixed list of types that a Go function can receive from the
-// interpreter.
-func (s *state) evalArg(t reflect.Type, n Node) reflect.Value {
-	param := s.walkNode(n)
-
-	// Extract the runtime types
-	tparam := param.Type().Kind()
-	expected := t.Kind()
+// Return the global environment, the outermost one of the chain.
+func (s *state) global() *state {
+	for s.outer != nil {
+		s = s.outer
+	}
+	return s
+}
 
-	// As a special case, unsigned number should be converted from the
-	// signed ones
-	switch expected {
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		if tparam == reflect.Int {
-			param = reflect.New(t).Elem()
-			param.SetUint(n.(*NumberNode).Uint64)
+// Bind the variables defined in a body to the unbound marker, until
+// their definitions are executed. Names already bound, like the
+// arguments, keep their value.
+func (s *state) reserve(names []string) {
+	for _, name := range names {
+		if _, ok := s.vars[name]; !ok {
+			s.vars[name] = unbound
 		}
 	}
+}
 
-	// Signal a type mismatching between the formal and current parameter
-	// interface{} it's an exception, because accepts all kind of types
-	if expected != reflect.Interface && expected != tparam {
-		s.errorf("incorrect argument type, expected %s, got %s", expected, tparam)
+// Return the innermost environment where the variable is defined,
+// or nil if there's none.
+func (s *state) scope(name string) *state {
+	for ; s != nil; s = s.outer {
+		if _, ok := s.vars[name]; ok {
+			return s
+		}
 	}
-
-	return param
+	return nil
 }
 
-func (s *state) walkUserCall(v reflect.Value, n *CallNode) reflect.Value {
-	// Check if the variable value it's really a lambda function,
-	// and not any other kind of value
-	if v.Type() != lambdaType {
-		s.errorf("the variable %s is not a function, cannot be called", n.Name)
+// Resolve the value of a variable through the lexical chain of environments.
+func (s *state) lookup(name string) (Value, bool) {
+	if env := s.scope(name); env != nil {
+		return env.vars[name], true
 	}
+	return nil, false
+}
 
-	f := v.Interface().(*lambdaValue)
-
+// Build the environment to execute the body of a user function,
+// with the arguments of the call.
+func (s *state) newCallState(f *lambdaValue, n *CallNode) *state {
 	// Check the arity of the func
-	if len(f.args) != len(n.Args) {
-		s.errorf("call doesn't use the correct arity: expected %d, got %s",
-			len(f.args), len(n.Args))
+	if !f.arity.accepts(len(n.Args)) {
+		s.errorf("%s", arityError(lambdaName(f.name), f.arity, len(n.Args)))
 	}
 
-	// Create the new sub-environment
+	// Create the new sub-environment, nested inside the one
+	// where the lambda was defined
 	env := &state{
 		vars:   make(variables),
 		output: s.output,
-		outer:  s,
+		outer:  f.env,
 	}
 
-	// Evaluate the arguments
+	env.reserve(f.defines)
+
+	// Evaluate the arguments, collecting the extra ones in a list
+	extra := []Value{}
 	for i, node := range n.Args {
-		env.vars[f.args[i]] = s.walkNode(node)
+		if i < len(f.args) {
+			env.vars[f.args[i]] = s.walkNode(node)
+		} else {
+			extra = append(extra, s.walkNode(node))
+		}
+	}
+	if f.rest != "" {
+		env.vars[f.rest] = list(extra...)
+	}
+
+	// The optional arguments that were omitted are filled later
+	for i := len(n.Args); i < len(f.args); i++ {
+		env.vars[f.args[i]] = unbound
 	}
 
-	return env.walkCall(f.body)
+	return env
 }
 
-func (s *state) walkDefine(n *DefineNode) reflect.Value {
+// Assign the default values of the optional arguments omitted in
+// a call. They're evaluated inside the called function.
+func (s *state) fillDefaults(f *lambdaValue, nargs int) {
+	required := len(f.args) - len(f.defaults)
+	for i := nargs; i < len(f.args); i++ {
+		var value Value = Bool(false)
+		if def := f.defaults[i-required]; def != nil {
+			value = s.walkNode(def)
+			nameLambda(value, f.args[i])
+		}
+		s.vars[f.args[i]] = value
+	}
+}
+
+func (s *state) walkDefine(n *DefineNode) Value {
 	name := n.Variable.Name
 
-	if _, ok := s.vars[name]; ok {
+	// The global variables can be defined again, to replace them
+	// in an interactive session
+	if v, ok := s.vars[name]; ok && v != unbound && s.outer != nil {
 		s.errorf("variable already defined: %s", name)
 	}
 
-	s.vars[name] = s.walkNode(n.Value)
-	return s.vars[name]
+	value := s.walkNode(n.Value)
+	nameLambda(value, name)
+
+	s.vars[name] = value
+	return value
 }
 
-func (s *state) walkSet(n *SetNode) reflect.Value {
+// Give a name to the lambdas assigned to variables, to identify
+// them in the errors.
+func nameLambda(v Value, name string) {
+	if f, ok := v.(*lambdaValue); ok && f.name == "" {
+		f.name = name
+	}
+}
+
+func (s *state) walkSet(n *SetNode) Value {
 	name := n.Variable.Name
 
-	if _, ok := s.vars[name]; !ok {
+	env := s.scope(name)
+	if env == nil || env.vars[name] == unbound {
 		s.errorf("variable not defined: %s", name)
 	}
 
-	s.vars[name] = s.walkNode(n.Value)
-	return s.vars[name]
+	env.vars[name] = s.walkNode(n.Value)
+	return env.vars[name]
 }
 
-func (s *state) walkIf(n *IfNode) reflect.Value {
-	test := s.walkNode(n.Test)
-	if test.Kind() == reflect.Bool {
-		if test.Bool() {
-			return s.walkNode(n.Conseq)
-		} else {
-			return s.walkNode(n.Alt)
+// Evaluate the test of the if, returning the branch that
+// should be executed.
+func (s *state) walkIf(n *IfNode) Node {
+	if isTrue(s.walkNode(n.Test)) {
+		return n.Conseq
+	}
+	return n.Alt
+}
+
+// Evaluate the expressions of an and until one of them is false,
+// returning its value, or the last expression to be executed in
+// tail position.
+func (s *state) walkAnd(n *AndNode) (Value, Node) {
+	if len(n.Nodes) == 0 {
+		return Bool(true), nil
+	}
+
+	last := len(n.Nodes) - 1
+	for _, node := range n.Nodes[:last] {
+		if v := s.walkNode(node); !isTrue(v) {
+			return v, nil
 		}
 	}
+	return nil, n.Nodes[last]
+}
 
-	s.errorf("if condition is not a boolean")
-	panic("not reached")
+// Evaluate the expressions of an or until one of them is true,
+// returning its value, or the last expression to be executed in
+// tail position.
+func (s *state) walkOr(n *OrNode) (Value, Node) {
+	if len(n.Nodes) == 0 {
+		return Bool(false), nil
+	}
+
+	last := len(n.Nodes) - 1
+	for _, node := range n.Nodes[:last] {
+		if v := s.walkNode(node); isTrue(v) {
+			return v, nil
+		}
+	}
+	return nil, n.Nodes[last]
 }
 
-func (s *state) walkBegin(n *BeginNode) (v reflect.Value) {
-	for _, node := range n.Nodes {
-		v = s.walkNode(node)
+// Evaluate the key of the case, returning the body of the clause
+// that contains it.
+func (s *state) walkCase(n *CaseNode) Node {
+	key := s.walkNode(n.Key)
+	for _, clause := range n.Clauses {
+		for _, d := range clause.Datums {
+			if eqv(key, datumValue(d)) {
+				return clause.Body
+			}
+		}
 	}
-	return
+	return n.Else
 }
 
-func (s *state) walkNumber(c *NumberNode) reflect.Value {
-	switch {
-	case c.IsInt:
-		n := int(c.Int64)
-		if int64(n) != c.Int64 {
-			s.errorf("%s overflows int", c.Text)
+// Build the environment of the body of a let with its variables.
+func (s *state) walkLet(n *LetNode) *state {
+	env := &state{
+		vars:   make(variables),
+		output: s.output,
+		outer:  s,
+	}
+	env.reserve(n.bodyDefines())
+
+	// The values of a letrec are evaluated inside the new environment,
+	// where all the variables exist but aren't defined until their
+	// value is assigned
+	if n.Rec {
+		for _, v := range n.Vars {
+			env.vars[v.(*VarNode).Name] = unbound
 		}
-		return reflect.ValueOf(n)
 	}
+	for i, node := range n.Values {
+		var value Value
+		if n.Rec {
+			value = env.walkNode(node)
+		} else {
+			value = s.walkNode(node)
+		}
 
-	panic("not reached")
+		name := n.Vars[i].(*VarNode).Name
+		nameLambda(value, name)
+		env.vars[name] = value
+	}
+
+	return env
 }
 
-func (s *state) walkVar(n *VarNode) reflect.Value {
-	value, ok := s.vars[n.Name]
-	if !ok {
+// Execute all the expressions except the last one, that it's
+// returned to be executed in tail position.
+func (s *state) walkBegin(n *BeginNode) Node {
+	last := len(n.Nodes) - 1
+	for _, node := range n.Nodes[:last] {
+		s.walkNode(node)
+	}
+	return n.Nodes[last]
+}
+
+func (s *state) walkNumber(c *NumberNode) Value {
+	return numberValue(c)
+}
+
+func (s *state) walkVar(n *VarNode) Value {
+	value, ok := s.lookup(n.Name)
+	if value == unbound {
 		s.errorf("variable not defined: %s", n.Name)
 	}
+	if !ok {
+		// Builtin functions can be used as values too
+		value, ok = s.evalFunction(n.Name)
+		if !ok {
+			s.errorf("variable not defined: %s", n.Name)
+		}
+	}
 	return value
 }
 
-func (s *state) walkBool(n *BoolNode) reflect.Value {
-	return reflect.ValueOf(n.Value)
+func (s *state) walkBool(n *BoolNode) Value {
+	return Bool(n.Value)
 }
 
-func (s *state) walkString(n *StringNode) reflect.Value {
-	return reflect.ValueOf(n.Text)
+func (s *state) walkString(n *StringNode) Value {
+	return String(n.Text)
 }
 
-func (s *state) walkLambda(n *LambdaNode) reflect.Value {
+func (s *state) walkLambda(n *LambdaNode) Value {
 	c := &lambdaValue{
-		args: make([]string, len(n.Args)),
-		body: n.Body.(*CallNode),
+		args:     make([]string, len(n.Args)),
+		defaults: n.Defaults,
+		defines:  n.bodyDefines(),
+		arity:    lambdaArity(n),
+		body:     n.Body,
+		env:      s,
 	}
 
 	for i, arg := range n.Args {
 		c.args[i] = arg.(*VarNode).Name
 	}
+	if n.Rest != nil {
+		c.rest = n.Rest.Name
+	}
 
-	return reflect.ValueOf(c)
+	return c
+}
+
+func lambdaArity(n *LambdaNode) arity {
+	a := arity{min: len(n.Args) - n.Optional, max: len(n.Args)}
+	if n.Rest != nil {
+		a.max = -1
+	}
+	return a
+}
+
+func (s *state) walkQuote(n *QuoteNode) Value {
+	return n.datum()
+}
+
+// ========================================================
+
+// Panic used by break to exit the innermost loop.
+type breakSignal struct {
+	value Value
+}
+
+// Run a loop, returning its value or the value of the break
+// that exits it.
+func (s *state) walkLoop(loop func() Value) (v Value) {
+	defer func() {
+		if e := recover(); e != nil {
+			b, ok := e.(*breakSignal)
+			if !ok {
+				panic(e)
+			}
+			v = b.value
+		}
+	}()
+
+	return loop()
+}
+
+func (s *state) walkBreak(n *BreakNode) {
+	var value Value = Nil{}
+	if n.Value != nil {
+		value = s.walkNode(n.Value)
+	}
+	panic(&breakSignal{value})
+}
+
+// Each iteration of a do runs in a new environment, so the closures
+// created by the body capture the values of that iteration.
+func (s *state) walkDo(n *DoNode) Value {
+	return s.walkLoop(func() Value {
+		values := make([]Value, len(n.Inits))
+		for i, node := range n.Inits {
+			values[i] = s.walkNode(node)
+		}
+
+		for {
+			env := &state{
+				vars:   make(variables),
+				output: s.output,
+				outer:  s,
+			}
+			env.reserve(n.bodyDefines())
+			for i, v := range n.Vars {
+				env.vars[v.(*VarNode).Name] = values[i]
+			}
+
+			if isTrue(env.walkNode(n.Test)) {
+				if n.Result == nil {
+					return Nil{}
+				}
+				return env.walkNode(n.Result)
+			}
+
+			if n.Body != nil {
+				env.walkNode(n.Body)
+			}
+
+			// Variables without step keep their current value
+			for i, step := range n.Steps {
+				if step == nil {
+					values[i] = env.vars[n.Vars[i].(*VarNode).Name]
+				} else {
+					values[i] = env.walkNode(step)
+				}
+			}
+		}
+	})
+}
+
+func (s *state) walkWhile(n *WhileNode) Value {
+	return s.walkLoop(func() Value {
+		for isTrue(s.walkNode(n.Test)) {
+			if n.Body != nil {
+				env := &state{
+					vars:   make(variables),
+					output: s.output,
+					outer:  s,
+				}
+				env.reserve(n.bodyDefines())
+				env.walkNode(n.Body)
+			}
+		}
+		return Nil{}
+	})
+}
+
+func (s *state) walkDotimes(n *DotimesNode) Value {
+	return s.walkLoop(func() Value {
+		v := s.walkNode(n.Count)
+		count, ok := v.(Int)
+		if !ok {
+			s.at(n.Count)
+			if _, tooLarge := v.(*BigInt); tooLarge {
+				s.errorf("dotimes count is too large")
+			}
+			s.errorf("dotimes count is not an integer")
+		}
+
+		for i := Int(0); i < count; i++ {
+			if n.Body != nil {
+				env := &state{
+					vars:   variables{n.Var.Name: i},
+					output: s.output,
+					outer:  s,
+				}
+				env.reserve(n.bodyDefines())
+				env.walkNode(n.Body)
+			}
+		}
+
+		// The result is evaluated with the variable bound to the count
+		if n.Result == nil {
+			return Nil{}
+		}
+		env := &state{
+			vars:   variables{n.Var.Name: count},
+			output: s.output,
+			outer:  s,
+		}
+		env.reserve(n.bodyDefines())
+		return env.walkNode(n.Result)
+	})
 }
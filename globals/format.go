@@ -2,12 +2,13 @@ package globals
 
 import (
 	"fmt"
+	"io"
 )
 
-func Print(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
+func Print(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, format, args...)
 }
 
-func Println(args ...interface{}) {
-	fmt.Println(args...)
+func Println(w io.Writer, args ...interface{}) {
+	fmt.Fprintln(w, args...)
 }
@@ -0,0 +1,387 @@
+package globals
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Integer arguments keep the results exact when it's possible, promoting
+// them to big integers if they don't fit in an int; the rest of them are
+// computed as floats.
+
+// Name of the type of an argument in the errors, using the names of
+// the interpreter for the Go types.
+func typeName(n interface{}) string {
+	switch n.(type) {
+	case int, *big.Int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func checkNumber(n interface{}) error {
+	if _, ok := toFloat(n); !ok {
+		return fmt.Errorf("expected a number, got %s", typeName(n))
+	}
+	return nil
+}
+
+// Floats without decimals are accepted as integers too, reporting
+// that the result should be inexact.
+func checkInteger(n interface{}) (b *big.Int, inexact bool, err error) {
+	if b, ok := toBig(n); ok {
+		return b, false, nil
+	}
+
+	if f, ok := n.(float64); ok {
+		if f != math.Trunc(f) || math.IsInf(f, 0) {
+			return nil, false, fmt.Errorf("expected an integer, got the float %v", f)
+		}
+		b, _ := big.NewFloat(f).Int(nil)
+		return b, true, nil
+	}
+
+	return nil, false, fmt.Errorf("expected an integer, got %s", typeName(n))
+}
+
+// Return an integer result, as a float if any of the arguments was
+// a float.
+func integerResult(b *big.Int, inexact bool) interface{} {
+	if inexact {
+		f, _ := new(big.Float).SetInt(b).Float64()
+		return f
+	}
+	return normalize(b)
+}
+
+// Apply a float function to any kind of number.
+func floatOp(n interface{}, f func(float64) float64) (interface{}, error) {
+	x, ok := toFloat(n)
+	if !ok {
+		return nil, fmt.Errorf("expected a number, got %s", typeName(n))
+	}
+	return f(x), nil
+}
+
+// Return the square root, exact if the number is the square of
+// an integer.
+func Sqrt(n interface{}) (interface{}, error) {
+	if b, ok := toBig(n); ok && b.Sign() >= 0 {
+		r := new(big.Int).Sqrt(b)
+		if new(big.Int).Mul(r, r).Cmp(b) == 0 {
+			return normalize(r), nil
+		}
+	}
+	return floatOp(n, math.Sqrt)
+}
+
+// Raise base to the power of exp, exactly when both of them are
+// integers and the exponent isn't negative.
+func Expt(base, exp interface{}) (interface{}, error) {
+	if err := checkNumber(base); err != nil {
+		return nil, err
+	}
+	if err := checkNumber(exp); err != nil {
+		return nil, err
+	}
+
+	b, bok := toBig(base)
+	e, eok := exp.(int)
+	if bok && eok && e >= 0 {
+		return normalize(new(big.Int).Exp(b, big.NewInt(int64(e)), nil)), nil
+	}
+
+	x, _ := toFloat(base)
+	y, _ := toFloat(exp)
+	return math.Pow(x, y), nil
+}
+
+func Exp(n interface{}) (interface{}, error) {
+	return floatOp(n, math.Exp)
+}
+
+// Return the natural logarithm of n, or the logarithm in the base
+// if it's given.
+func Log(n interface{}, base ...interface{}) (interface{}, error) {
+	x, err := logarithm(n)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(base) {
+	case 0:
+		return x, nil
+	case 1:
+		y, err := logarithm(base[0])
+		if err != nil {
+			return nil, err
+		}
+		return x / y, nil
+	}
+	return nil, fmt.Errorf("expected only the number and the base")
+}
+
+func logarithm(n interface{}) (float64, error) {
+	// Big integers may be too large to be converted to a float,
+	// so the lower bits are discarded
+	if b, ok := n.(*big.Int); ok && b.Sign() > 0 {
+		shift := b.BitLen() - 64
+		if shift > 0 {
+			f, _ := new(big.Float).SetInt(new(big.Int).Rsh(b, uint(shift))).Float64()
+			return math.Log(f) + float64(shift)*math.Ln2, nil
+		}
+	}
+
+	x, ok := toFloat(n)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %s", typeName(n))
+	}
+	return math.Log(x), nil
+}
+
+func Sin(n interface{}) (interface{}, error) {
+	return floatOp(n, math.Sin)
+}
+
+func Cos(n interface{}) (interface{}, error) {
+	return floatOp(n, math.Cos)
+}
+
+func Tan(n interface{}) (interface{}, error) {
+	return floatOp(n, math.Tan)
+}
+
+// Return the arc tangent of y, or of y/x using the signs of both
+// numbers to find the quadrant if x is given.
+func Atan(y interface{}, x ...interface{}) (interface{}, error) {
+	switch len(x) {
+	case 0:
+		return floatOp(y, math.Atan)
+	case 1:
+		fy, yok := toFloat(y)
+		fx, xok := toFloat(x[0])
+		if !yok || !xok {
+			return nil, fmt.Errorf("expected two numbers")
+		}
+		return math.Atan2(fy, fx), nil
+	}
+	return nil, fmt.Errorf("expected one or two numbers")
+}
+
+// ========================================================
+
+// Integers are already rounded, so they're returned as they are.
+func round(n interface{}, f func(float64) float64) (interface{}, error) {
+	if _, ok := toBig(n); ok {
+		return n, nil
+	}
+	return floatOp(n, f)
+}
+
+func Floor(n interface{}) (interface{}, error) {
+	return round(n, math.Floor)
+}
+
+func Ceiling(n interface{}) (interface{}, error) {
+	return round(n, math.Ceil)
+}
+
+// Round to the nearest integer, and to the even one in the ties.
+func Round(n interface{}) (interface{}, error) {
+	return round(n, math.RoundToEven)
+}
+
+func Truncate(n interface{}) (interface{}, error) {
+	return round(n, math.Trunc)
+}
+
+func Abs(n interface{}) (interface{}, error) {
+	if b, ok := toBig(n); ok {
+		if i, ok := n.(int); ok && i != math.MinInt {
+			if i < 0 {
+				return -i, nil
+			}
+			return i, nil
+		}
+		return normalize(new(big.Int).Abs(b)), nil
+	}
+	return floatOp(n, math.Abs)
+}
+
+// Return the smallest or the largest number, as a float if any
+// of them is a float. The result is NaN if any of them is NaN.
+func extreme(name string, args []interface{}, sign int) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("at least one number is needed for %s", name)
+	}
+
+	res := args[0]
+	inexact, nan := false, false
+	for _, arg := range args {
+		c, err := compare(arg, res)
+		if err != nil {
+			return nil, err
+		}
+		if c == sign {
+			res = arg
+		}
+		if _, ok := arg.(float64); ok {
+			inexact = true
+		}
+		if isNaN(arg) {
+			nan = true
+		}
+	}
+
+	if nan {
+		return math.NaN(), nil
+	}
+	if inexact {
+		f, _ := toFloat(res)
+		return f, nil
+	}
+	return res, nil
+}
+
+func Min(args ...interface{}) (interface{}, error) {
+	return extreme("min", args, -1)
+}
+
+func Max(args ...interface{}) (interface{}, error) {
+	return extreme("max", args, 1)
+}
+
+// Return the greatest common divisor of the integers, that it's
+// always positive or zero.
+func Gcd(args ...interface{}) (interface{}, error) {
+	res := new(big.Int)
+	inexact := false
+	for _, arg := range args {
+		b, isFloat, err := checkInteger(arg)
+		if err != nil {
+			return nil, err
+		}
+		inexact = inexact || isFloat
+		res.GCD(nil, nil, res, new(big.Int).Abs(b))
+	}
+	return integerResult(res, inexact), nil
+}
+
+// Return the least common multiple of the integers, that it's
+// always positive or zero.
+func Lcm(args ...interface{}) (interface{}, error) {
+	res := big.NewInt(1)
+	inexact := false
+	for _, arg := range args {
+		b, isFloat, err := checkInteger(arg)
+		if err != nil {
+			return nil, err
+		}
+		inexact = inexact || isFloat
+		if b.Sign() == 0 {
+			return integerResult(b, inexact), nil
+		}
+
+		b = new(big.Int).Abs(b)
+		gcd := new(big.Int).GCD(nil, nil, res, b)
+		res.Mul(res, new(big.Int).Quo(b, gcd))
+	}
+	return integerResult(res, inexact), nil
+}
+
+// Divide two integers. The quotient is truncated towards zero, the
+// remainder has the sign of the dividend and the modulo the sign
+// of the divisor.
+func divide(a, b interface{}, fn func(q, r, x, y *big.Int) *big.Int) (interface{}, error) {
+	x, xinexact, err := checkInteger(a)
+	if err != nil {
+		return nil, err
+	}
+	y, yinexact, err := checkInteger(b)
+	if err != nil {
+		return nil, err
+	}
+	if y.Sign() == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	return integerResult(fn(q, r, x, y), xinexact || yinexact), nil
+}
+
+func Quotient(a, b interface{}) (interface{}, error) {
+	return divide(a, b, func(q, r, x, y *big.Int) *big.Int {
+		return q
+	})
+}
+
+func Remainder(a, b interface{}) (interface{}, error) {
+	return divide(a, b, func(q, r, x, y *big.Int) *big.Int {
+		return r
+	})
+}
+
+// Unlike the % operator, the result has the sign of the divisor.
+func FlooredModulo(a, b interface{}) (interface{}, error) {
+	return divide(a, b, func(q, r, x, y *big.Int) *big.Int {
+		if r.Sign() != 0 && r.Sign() != y.Sign() {
+			r.Add(r, y)
+		}
+		return r
+	})
+}
+
+// ========================================================
+
+// The generator is shared by all the interpreters.
+var (
+	randMu sync.Mutex
+	rng    = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Return a random number between zero and n, excluding n, of the
+// same type of n.
+func Random(n interface{}) (interface{}, error) {
+	randMu.Lock()
+	defer randMu.Unlock()
+
+	switch n := n.(type) {
+	case int:
+		if n <= 0 {
+			return nil, fmt.Errorf("expected a positive limit, got %d", n)
+		}
+		return rng.Intn(n), nil
+
+	case *big.Int:
+		if n.Sign() <= 0 {
+			return nil, fmt.Errorf("expected a positive limit, got %s", n)
+		}
+		return normalize(new(big.Int).Rand(rng, n)), nil
+
+	case float64:
+		if n <= 0 {
+			return nil, fmt.Errorf("expected a positive limit, got %v", n)
+		}
+		return rng.Float64() * n, nil
+	}
+
+	return nil, fmt.Errorf("expected a number, got %s", typeName(n))
+}
+
+// Seed the generator, to repeat the same sequence of random numbers.
+func RandomSeed(seed int) {
+	randMu.Lock()
+	defer randMu.Unlock()
+
+	rng.Seed(int64(seed))
+}
@@ -2,17 +2,62 @@ package globals
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
 )
 
-type intFunc func(a, b int) int
+// Integer operations return false when the result cannot be represented
+// exactly by an int (overflows, not-exact divisions, etc.)
+type intFunc func(a, b int) (int, bool)
+type bigFunc func(z, a, b *big.Int) *big.Int
+type floatFunc func(a, b float64) float64
 
 var (
 	intFuncs = map[string]intFunc{
-		"plus":   func(a, b int) int { return a + b },
-		"minus":  func(a, b int) int { return a - b },
-		"times":  func(a, b int) int { return a * b },
-		"divide": func(a, b int) int { return a / b },
-		"modulo": func(a, b int) int { return a % b },
+		"plus": func(a, b int) (int, bool) {
+			c := a + b
+			return c, (c > a) == (b > 0)
+		},
+		"minus": func(a, b int) (int, bool) {
+			c := a - b
+			return c, (c < a) == (b > 0)
+		},
+		"times": func(a, b int) (int, bool) {
+			if a == 0 || b == 0 {
+				return 0, true
+			}
+			c := a * b
+			return c, c/b == a && !(a == -1 && b == math.MinInt) && !(b == -1 && a == math.MinInt)
+		},
+		"divide": func(a, b int) (int, bool) {
+			if b == 0 || a%b != 0 || (a == math.MinInt && b == -1) {
+				return 0, false
+			}
+			return a / b, true
+		},
+		"modulo": func(a, b int) (int, bool) {
+			if b == 0 {
+				return 0, false
+			}
+			return a % b, true
+		},
+	}
+
+	bigFuncs = map[string]bigFunc{
+		"plus":   (*big.Int).Add,
+		"minus":  (*big.Int).Sub,
+		"times":  (*big.Int).Mul,
+		"divide": (*big.Int).Quo,
+		"modulo": (*big.Int).Rem,
+	}
+
+	floatFuncs = map[string]floatFunc{
+		"plus":   func(a, b float64) float64 { return a + b },
+		"minus":  func(a, b float64) float64 { return a - b },
+		"times":  func(a, b float64) float64 { return a * b },
+		"divide": func(a, b float64) float64 { return a / b },
+		"modulo": math.Mod,
 	}
 )
 
@@ -28,22 +73,177 @@ func op(name string, args []interface{}) (interface{}, error) {
 		return 0, fmt.Errorf("at least two params are needed for the %s operator", name)
 	}
 
-	// Try to sum the integers
-	ac, ok := args[0].(int)
-	if ok {
-		f := intFuncs[name]
-		for _, arg := range args[1:] {
-			n := arg.(int)
-			if name == "divide" && n == 0 {
+	ac := args[0]
+	for _, arg := range args[1:] {
+		// Operate the integers while both of them are integers
+		a, aok := ac.(int)
+		b, bok := arg.(int)
+		if aok && bok {
+			if res, ok := intFuncs[name](a, b); ok {
+				ac = res
+				continue
+			}
+		}
+
+		// Promote the integers to big integers if they overflow
+		x, xok := toBig(ac)
+		y, yok := toBig(arg)
+		if xok && yok {
+			if (name == "divide" || name == "modulo") && y.Sign() == 0 {
 				return ac, fmt.Errorf("division by zero")
 			}
 
-			ac = f(ac, n)
+			// Not-exact divisions are promoted to floats
+			if name != "divide" || new(big.Int).Rem(x, y).Sign() == 0 {
+				ac = normalize(bigFuncs[name](new(big.Int), x, y))
+				continue
+			}
+		}
+
+		// Promote the integers to floats
+		fx, xok := toFloat(ac)
+		fy, yok := toFloat(arg)
+		if !xok || !yok {
+			return 0, fmt.Errorf("%s operator can't handle this kind of numbers", name)
+		}
+
+		ac = floatFuncs[name](fx, fy)
+	}
+
+	return ac, nil
+}
+
+// Convert any kind of number to a float.
+func toFloat(n interface{}) (float64, bool) {
+	switch n := n.(type) {
+	case int:
+		return float64(n), true
+
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// Convert any kind of integer to a big integer.
+func toBig(n interface{}) (*big.Int, bool) {
+	switch n := n.(type) {
+	case int:
+		return big.NewInt(int64(n)), true
+
+	case *big.Int:
+		return n, true
+	}
+
+	return nil, false
+}
+
+// Return the big integer as an int if it fits in one.
+func normalize(n *big.Int) interface{} {
+	if n.IsInt64() {
+		if i := int(n.Int64()); int64(i) == n.Int64() {
+			return i
+		}
+	}
+	return n
+}
+
+// Compare two numbers, returning -1, 0 or +1 if the first one is
+// less than, equal to or greater than the second one. NaN compares
+// as equal to any number, so it should be checked apart.
+func compare(a, b interface{}) (int, error) {
+	x, aok := a.(int)
+	y, bok := b.(int)
+	if aok && bok {
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
 		}
-		return ac, nil
+		return 0, nil
+	}
+
+	bx, aok := toBig(a)
+	by, bok := toBig(b)
+	if aok && bok {
+		return bx.Cmp(by), nil
+	}
+
+	fx, aok := toFloat(a)
+	fy, bok := toFloat(b)
+	if !aok || !bok {
+		return 0, fmt.Errorf("cannot compare non-numeric values")
+	}
+	if math.IsNaN(fx) || math.IsNaN(fy) {
+		return 0, nil
 	}
 
-	return 0, fmt.Errorf("%s operator can't handle this kind of numbers", name)
+	// Integers are compared with the floats without rounding them,
+	// so the big ones keep all their digits
+	_, xfloat := a.(float64)
+	_, yfloat := b.(float64)
+	if !xfloat || !yfloat {
+		return toBigFloat(a).Cmp(toBigFloat(b)), nil
+	}
+
+	switch {
+	case fx < fy:
+		return -1, nil
+	case fx > fy:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Convert any kind of number to a big float without losing precision.
+func toBigFloat(n interface{}) *big.Float {
+	switch n := n.(type) {
+	case int:
+		return new(big.Float).SetInt64(int64(n))
+	case *big.Int:
+		return new(big.Float).SetInt(n)
+	}
+	f, _ := toFloat(n)
+	return new(big.Float).SetFloat64(f)
+}
+
+func isNaN(n interface{}) bool {
+	f, ok := n.(float64)
+	return ok && math.IsNaN(f)
+}
+
+// Check that the test holds for each number and the next one, so
+// (< a b c) means a < b < c. Comparisons with NaN are always false, and
+// a single number is always true.
+func chain(name string, args []interface{}, test func(c int) bool) (interface{}, error) {
+	switch len(args) {
+	case 0:
+		return false, fmt.Errorf("at least one param is needed for the %s operator", name)
+	case 1:
+		if _, err := compare(args[0], args[0]); err != nil {
+			return false, err
+		}
+	}
+
+	// All the arguments are checked, even after a false comparison
+	res := true
+	for i := 1; i < len(args); i++ {
+		c, err := compare(args[i-1], args[i])
+		if err != nil {
+			return false, err
+		}
+		if isNaN(args[i-1]) || isNaN(args[i]) || !test(c) {
+			res = false
+		}
+	}
+
+	return res, nil
 }
 
 func Plus(args ...interface{}) (interface{}, error) {
@@ -66,26 +266,49 @@ func Modulo(args ...interface{}) (interface{}, error) {
 	return op("modulo", args)
 }
 
-func GreaterThan(a, b int) bool {
-	return a > b
+func GreaterThan(args ...interface{}) (interface{}, error) {
+	return chain(">", args, func(c int) bool { return c > 0 })
 }
 
-func GreaterEqual(a, b int) bool {
-	return a >= b
+func GreaterEqual(args ...interface{}) (interface{}, error) {
+	return chain(">=", args, func(c int) bool { return c >= 0 })
 }
 
-func LessThan(a, b int) bool {
-	return a < b
+func LessThan(args ...interface{}) (interface{}, error) {
+	return chain("<", args, func(c int) bool { return c < 0 })
 }
 
-func LessEqual(a, b int) bool {
-	return a <= b
+func LessEqual(args ...interface{}) (interface{}, error) {
+	return chain("<=", args, func(c int) bool { return c <= 0 })
 }
 
-func Equal(a, b interface{}) bool {
-	return a == b
+// Numbers are equal if they have the same value, even with different
+// types: (= 1 1.0) is true. The rest of values are compared like eqv?
+// does; equal? compares the contents of the lists.
+func Equal(args ...interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if _, ok := toFloat(arg); !ok {
+			return identical(args), nil
+		}
+	}
+	return chain("=", args, func(c int) bool { return c == 0 })
+}
+
+// Report if all the values are the same one. Values of different types
+// are never identical, even if they're numbers.
+func identical(args []interface{}) bool {
+	for i := 1; i < len(args); i++ {
+		a, b := args[i-1], args[i]
+		t := reflect.TypeOf(a)
+		if t == nil || t != reflect.TypeOf(b) || !t.Comparable() || a != b {
+			return false
+		}
+	}
+	return true
 }
 
-func Not(a bool) bool {
-	return !a
+// Return true only for #f, the only false value.
+func Not(a interface{}) bool {
+	b, ok := a.(bool)
+	return ok && !b
 }
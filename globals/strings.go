@@ -0,0 +1,123 @@
+package globals
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings are indexed by characters instead of bytes, so the positions
+// work the same with any unicode text.
+
+func StringAppend(args ...string) string {
+	return strings.Join(args, "")
+}
+
+func StringLength(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// Return the characters of s from start to the end, or to the
+// optional end index if it's given.
+func Substring(s string, start int, end ...int) (string, error) {
+	r := []rune(s)
+
+	stop := len(r)
+	switch len(end) {
+	case 0:
+	case 1:
+		stop = end[0]
+	default:
+		return "", fmt.Errorf("expected only the start and the end indexes")
+	}
+
+	if start < 0 || start > stop || stop > len(r) {
+		return "", fmt.Errorf("range [%d, %d) out of bounds for a string of length %d", start, stop, len(r))
+	}
+
+	return string(r[start:stop]), nil
+}
+
+// Split s around each instance of the separator, or around the runs of
+// whitespace if it's not given.
+func StringSplit(s string, sep ...string) ([]string, error) {
+	switch len(sep) {
+	case 0:
+		return strings.Fields(s), nil
+	case 1:
+		return strings.Split(s, sep[0]), nil
+	}
+	return nil, fmt.Errorf("expected only one separator")
+}
+
+// Concatenate a list of strings, with an optional separator
+// between them.
+func StringJoin(items []string, sep ...string) (string, error) {
+	switch len(sep) {
+	case 0:
+		return strings.Join(items, ""), nil
+	case 1:
+		return strings.Join(items, sep[0]), nil
+	}
+	return "", fmt.Errorf("expected only one separator")
+}
+
+// Return the index of the first instance of sub in s, or false if
+// it's not present.
+func StringIndex(s, sub string) interface{} {
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return false
+	}
+	return utf8.RuneCountInString(s[:i])
+}
+
+func StringUpcase(s string) string {
+	return strings.ToUpper(s)
+}
+
+func StringDowncase(s string) string {
+	return strings.ToLower(s)
+}
+
+func StringTrim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func StringReplace(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// Numbers accepted in the code: decimal, octal with a leading zero or
+// hexadecimal integers, and decimal floats.
+var numberSyntax = regexp.MustCompile(`^[+-]?(0[xX][0-9a-fA-F]+|[0-9]+(\.[0-9]*)?([eE][+-]?[0-9]+)?)$`)
+
+// Read a number with the same syntax of the code, returning false
+// if the string is not a valid number.
+func StringToNumber(s string) interface{} {
+	if !numberSyntax.MatchString(s) {
+		return false
+	}
+
+	if i, err := strconv.ParseInt(s, 0, 0); err == nil {
+		return int(i)
+	}
+
+	if b, ok := new(big.Int).SetString(s, 0); ok {
+		return b
+	}
+
+	// Integers like 08 are not valid, even if they're valid floats
+	if strings.ContainsAny(s, ".eE") && !strings.ContainsAny(s, "xX") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil || errors.Is(err, strconv.ErrRange) {
+			return f
+		}
+	}
+
+	return false
+}
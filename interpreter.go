@@ -0,0 +1,257 @@
+package water
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ernestokarim/water/globals"
+)
+
+// Ways to execute the code.
+type Backend int
+
+const (
+	// Walk the syntax tree of the code
+	TreeWalker Backend = iota
+
+	// Compile the code to bytecode and run it in a stack machine
+	BytecodeVM
+)
+
+// Default maximum number of nested calls to user functions. The calls
+// in tail position don't count, because they replace the calling function.
+const defaultMaxDepth = 100000
+
+// An Interpreter keeps a global environment between the executions, so
+// the variables defined by a piece of code can be used by the next ones.
+// It's not safe to use it concurrently.
+type Interpreter struct {
+	global   *state
+	backend  Backend
+	executed bool // some code was run with the backend
+	vm       *vm
+	macros   macros
+}
+
+// Create an interpreter with the builtin functions of the language.
+func NewInterpreter() *Interpreter {
+	global := newGlobalState(os.Stdout)
+	for _, funcs := range []map[string]interface{}{initGlobalFuncs(global), initStringFuncs(), initMathFuncs()} {
+		for name, fn := range funcs {
+			if err := global.register(name, fn); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	return &Interpreter{
+		global: global,
+		vm:     newVM(global),
+		macros: make(macros),
+	}
+}
+
+// Change the backend that executes the code. Functions created with a
+// backend cannot be called from the other one, so it cannot be changed
+// once some code has been executed.
+func (in *Interpreter) SetBackend(b Backend) error {
+	if in.executed && b != in.backend {
+		return fmt.Errorf("cannot change the backend after executing code")
+	}
+	in.backend = b
+	return nil
+}
+
+// Execute each top-level expression, passing its value to fn.
+func (in *Interpreter) run(tree *ListNode, fn func(v Value)) error {
+	in.executed = true
+	for _, n := range tree.Nodes {
+		var v Value
+		var err error
+		if in.backend == BytecodeVM {
+			var p *proto
+			if p, err = compile(n); err == nil {
+				v, err = in.vm.run(p)
+			}
+		} else {
+			v, err = in.global.walkTop(n)
+		}
+		if err != nil {
+			return err
+		}
+
+		fn(v)
+	}
+
+	return nil
+}
+
+// Evaluate the code, returning the value of the last expression, or Nil
+// if it doesn't have any value.
+func (in *Interpreter) Eval(src string) (Value, error) {
+	return in.EvalReader("<eval>", strings.NewReader(src))
+}
+
+// Evaluate the code read from r; name identifies the source in the
+// error messages.
+func (in *Interpreter) EvalReader(name string, r io.Reader) (Value, error) {
+	tree, err := in.Parse(name, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var last Value = Nil{}
+	err = in.run(tree, func(v Value) {
+		last = v
+	})
+	if err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+// Parse the code with the macros defined by the previous code parsed
+// by the interpreter.
+func (in *Interpreter) Parse(name string, r io.Reader) (*ListNode, error) {
+	return parse(name, r, in.macros)
+}
+
+// Execute the code, printing the value of each top-level expression
+// to the output. The print functions write to it too until the code
+// ends, and then they go back to the output of the interpreter.
+func (in *Interpreter) Exec(output io.Writer, tree *ListNode) error {
+	prev := in.global.output
+	in.global.output = output
+	defer func() {
+		in.global.output = prev
+	}()
+
+	return in.run(tree, in.global.print)
+}
+
+// Change the maximum number of nested calls to user functions, after
+// which the execution stops with a stack overflow error. Each call of
+// the tree walker uses some stack of the goroutine, that it's limited
+// by the Go runtime too.
+func (in *Interpreter) SetMaxDepth(n int) {
+	in.global.maxDepth = n
+}
+
+// Change the output where the print functions write, that it's the
+// standard output by default.
+func (in *Interpreter) SetOutput(output io.Writer) {
+	in.global.output = output
+}
+
+// Define a global variable with a Go value, converted with ValueOf.
+func (in *Interpreter) Define(name string, value interface{}) {
+	in.global.vars[name] = ValueOf(value)
+}
+
+// Register a Go function as a builtin. It can receive any number of
+// arguments, and return a value and optionally an error as the last value.
+// The arguments are converted to the types of the parameters, except for
+// the functions that receive and return Value, that are called directly.
+func (in *Interpreter) Register(name string, fn interface{}) error {
+	return in.global.register(name, fn)
+}
+
+func initGlobalFuncs(global *state) map[string]interface{} {
+	return map[string]interface{}{
+		"+":       globals.Plus,
+		"-":       globals.Minus,
+		"*":       globals.Times,
+		"/":       globals.Divide,
+		"%":       globals.Modulo,
+		">":       globals.GreaterThan,
+		">=":      globals.GreaterEqual,
+		"<":       globals.LessThan,
+		"<=":      globals.LessEqual,
+		"=":       globals.Equal,
+		"print":   global.printFormat,
+		"println": global.printLine,
+		"not":     globals.Not,
+		"list":    listFunc,
+		"cons":    cons,
+		"car":     car,
+		"cdr":     cdr,
+		"null?":   null,
+		"length":  length,
+		"append":  appendLists,
+		"eq?":     eqvFunc,
+		"eqv?":    eqvFunc,
+		"equal?":  equalFunc,
+	}
+}
+
+// Builtins that print to the output of the environment.
+func (s *state) printFormat(format string, args ...Value) {
+	globals.Print(s.output, format, printArgs(args)...)
+}
+
+func (s *state) printLine(args ...Value) {
+	globals.Println(s.output, printArgs(args)...)
+}
+
+// The values are printed with their own syntax, so the floats keep their
+// decimal point. Big integers are passed as Go integers to format them
+// with the integer verbs too.
+func printArgs(args []Value) []interface{} {
+	res := make([]interface{}, len(args))
+	for i, arg := range args {
+		if b, ok := arg.(*BigInt); ok {
+			res[i] = (*big.Int)(b)
+		} else {
+			res[i] = arg
+		}
+	}
+	return res
+}
+
+func initStringFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"string-append":   globals.StringAppend,
+		"substring":       globals.Substring,
+		"string-length":   globals.StringLength,
+		"string-split":    globals.StringSplit,
+		"string-join":     globals.StringJoin,
+		"string-index":    globals.StringIndex,
+		"string-upcase":   globals.StringUpcase,
+		"string-downcase": globals.StringDowncase,
+		"string-trim":     globals.StringTrim,
+		"string-replace":  globals.StringReplace,
+		"string->number":  globals.StringToNumber,
+		"number->string":  numberToString,
+		"format":          format,
+	}
+}
+
+func initMathFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"sqrt":        globals.Sqrt,
+		"expt":        globals.Expt,
+		"exp":         globals.Exp,
+		"log":         globals.Log,
+		"sin":         globals.Sin,
+		"cos":         globals.Cos,
+		"tan":         globals.Tan,
+		"atan":        globals.Atan,
+		"floor":       globals.Floor,
+		"ceiling":     globals.Ceiling,
+		"round":       globals.Round,
+		"truncate":    globals.Truncate,
+		"abs":         globals.Abs,
+		"min":         globals.Min,
+		"max":         globals.Max,
+		"gcd":         globals.Gcd,
+		"lcm":         globals.Lcm,
+		"quotient":    globals.Quotient,
+		"remainder":   globals.Remainder,
+		"modulo":      globals.FlooredModulo,
+		"random":      globals.Random,
+		"random-seed": globals.RandomSeed,
+	}
+}
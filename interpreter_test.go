@@ -0,0 +1,305 @@
+package water_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ernestokarim/water"
+)
+
+var backends = []struct {
+	name    string
+	backend water.Backend
+}{
+	{"walker", water.TreeWalker},
+	{"vm", water.BytecodeVM},
+}
+
+// Create an interpreter for each backend.
+func eachBackend(t *testing.T, fn func(t *testing.T, in *water.Interpreter)) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			in := water.NewInterpreter()
+			if err := in.SetBackend(b.backend); err != nil {
+				t.Fatal(err)
+			}
+			fn(t, in)
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"(+ 1 2)", "3"},
+		{"(define x 2) (* x 2.5)", "5.0"},
+		{"(list 1 \"a\" 'b)", `(1 "a" b)`},
+		{"(define y 1)", "1"},
+		{"", ""},
+	}
+
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		for _, test := range tests {
+			v, err := in.Eval(test.src)
+			if err != nil {
+				t.Errorf("%q: %s", test.src, err)
+				continue
+			}
+			if got := fmt.Sprint(v); got != test.want {
+				t.Errorf("%q: got %s, want %s", test.src, got, test.want)
+			}
+		}
+	})
+}
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		if _, err := in.Eval("(define square (lambda (x) (* x x)))"); err != nil {
+			t.Fatal(err)
+		}
+		v, err := in.Eval("(square 7)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != water.Int(49) {
+			t.Errorf("got %s, want 49", v)
+		}
+	})
+}
+
+func TestEvalReaderErrors(t *testing.T) {
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		_, err := in.EvalReader("script.lisp", strings.NewReader("(car 1)"))
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, ok := err.(*water.RuntimeError); !ok {
+			t.Errorf("got %T, want a *RuntimeError", err)
+		}
+		if !strings.HasPrefix(err.Error(), "script.lisp:1:1: ") {
+			t.Errorf("the error is not located in the source: %s", err)
+		}
+
+		_, err = in.EvalReader("script.lisp", strings.NewReader("(car 1"))
+		if _, ok := err.(*water.ParseError); !ok {
+			t.Errorf("got %T, want a *ParseError", err)
+		}
+	})
+}
+
+func TestDefine(t *testing.T) {
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		in.Define("limit", 10)
+		in.Define("names", []string{"a", "b"})
+		v, err := in.Eval("(list (+ limit 1) (car (cdr names)))")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.String(); got != `(11 "b")` {
+			t.Errorf(`got %s, want (11 "b")`, got)
+		}
+	})
+}
+
+func sum(xs []int) int {
+	n := 0
+	for _, x := range xs {
+		n += x
+	}
+	return n
+}
+
+func TestRegister(t *testing.T) {
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		funcs := map[string]interface{}{
+			"shout":  strings.ToUpper,
+			"half":   func(x float64) float64 { return x / 2 },
+			"byte":   func(b uint8) uint8 { return b },
+			"sum":    sum,
+			"join":   func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+			"values": func(args ...water.Value) (water.Value, error) { return water.Int(len(args)), nil },
+		}
+		for name, fn := range funcs {
+			if err := in.Register(name, fn); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			src, want string
+		}{
+			{`(shout "hi")`, "HI"},
+			{"(half 3)", "1.5"},
+			{"(byte 255)", "255"},
+			{"(sum (list 1 2 3))", "6"},
+			{`(join "-" "a" "b" "c")`, "a-b-c"},
+			{"(values 1 'a \"b\")", "3"},
+		}
+		for _, test := range tests {
+			v, err := in.Eval(test.src)
+			if err != nil {
+				t.Errorf("%s: %s", test.src, err)
+				continue
+			}
+			if got := v.String(); got != test.want {
+				t.Errorf("%s: got %s, want %s", test.src, got, test.want)
+			}
+		}
+	})
+}
+
+func TestRegisterConversionErrors(t *testing.T) {
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		in.Register("shout", strings.ToUpper)
+		in.Register("byte", func(b uint8) uint8 { return b })
+		in.Register("sum", sum)
+		in.Register("fail", func() (int, error) { return 0, fmt.Errorf("failed") })
+
+		tests := []struct {
+			src, want string
+		}{
+			{"(shout 1)", "incorrect argument type, expected string, got int"},
+			{"(byte 256)", "integer out of range for uint8: 256"},
+			{"(byte -1)", "integer out of range for uint8: -1"},
+			{`(sum (list 1 "a"))`, "incorrect argument type, expected int, got string"},
+			{`(shout "a" "b")`, "wrong number of args for shout: want 1, got 2"},
+			{"(fail)", "error calling fail: failed"},
+		}
+		for _, test := range tests {
+			_, err := in.Eval(test.src)
+			if err == nil {
+				t.Errorf("%s: expected an error", test.src)
+				continue
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("%s: got %q, want %q", test.src, err, test.want)
+			}
+		}
+	})
+}
+
+func TestRegisterInvalidFunctions(t *testing.T) {
+	in := water.NewInterpreter()
+
+	tests := []struct {
+		fn   interface{}
+		want string
+	}{
+		{42, "int is not a function"},
+		{func() (int, int) { return 1, 2 }, "can't handle the returns of func() (int, int)"},
+	}
+	for _, test := range tests {
+		err := in.Register("f", test.fn)
+		if err == nil {
+			t.Errorf("%T: expected an error", test.fn)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%T: got %q, want %q", test.fn, err, test.want)
+		}
+	}
+}
+
+func TestSetBackendAfterRun(t *testing.T) {
+	in := water.NewInterpreter()
+	if err := in.SetBackend(water.BytecodeVM); err != nil {
+		t.Fatalf("changing the backend before running any code: %s", err)
+	}
+	if _, err := in.Eval("(define f (lambda () 1))"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := in.SetBackend(water.BytecodeVM); err != nil {
+		t.Errorf("setting the same backend again: %s", err)
+	}
+	err := in.SetBackend(water.TreeWalker)
+	if err == nil || err.Error() != "cannot change the backend after executing code" {
+		t.Errorf("got %v, want an error changing the backend", err)
+	}
+
+	v, err := in.Eval("(f)")
+	if err != nil || v != water.Int(1) {
+		t.Errorf("got %v, %v; want the function to keep working in the vm", v, err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		var out, def bytes.Buffer
+		in.SetOutput(&def)
+
+		root, err := in.Parse("<test>", strings.NewReader(`(+ 1 2) (print "a") (define x 1) "b"`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := in.Exec(&out, root); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := out.String(), "3\na1\nb"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+
+		// The output of the interpreter is restored after the execution
+		if _, err := in.Eval(`(print "c")`); err != nil {
+			t.Fatal(err)
+		}
+		if got := def.String(); got != "c" {
+			t.Errorf("got %q in the output of the interpreter, want %q", got, "c")
+		}
+		if got, want := out.String(), "3\na1\nb"; got != want {
+			t.Errorf("Eval wrote to the output of the last Exec: %q", got)
+		}
+	})
+}
+
+func TestParseMacros(t *testing.T) {
+	in := water.NewInterpreter()
+	if _, err := in.Eval("(define-syntax swap! (syntax-rules () ((_ a b) (let ((tmp a)) (set a b) (set b tmp)))))"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The macros defined by the previous code are expanded
+	v, err := in.Eval("(define p 1) (define q 2) (swap! p q) (list p q)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "(2 1)" {
+		t.Errorf("got %s, want (2 1)", got)
+	}
+}
+
+func TestSetMaxDepth(t *testing.T) {
+	const sum = "(define sum (lambda (n) (if (= n 0) 0 (+ n (sum (- n 1))))))"
+
+	eachBackend(t, func(t *testing.T, in *water.Interpreter) {
+		if _, err := in.Eval(sum); err != nil {
+			t.Fatal(err)
+		}
+
+		// The default limit allows deep recursions
+		v, err := in.Eval("(sum 20000)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != water.Int(200010000) {
+			t.Errorf("got %s, want 200010000", v)
+		}
+
+		in.SetMaxDepth(100)
+		if _, err := in.Eval("(sum 99)"); err != nil {
+			t.Errorf("100 nested calls: %s", err)
+		}
+		_, err = in.Eval("(sum 100)")
+		if err == nil || !strings.Contains(err.Error(), "stack overflow") {
+			t.Errorf("got %v, want a stack overflow", err)
+		}
+
+		// Tail calls don't count
+		if _, err := in.Eval("(define loop (lambda (n) (if (= n 0) 0 (loop (- n 1))))) (loop 1000)"); err != nil {
+			t.Errorf("tail calls: %s", err)
+		}
+	})
+}
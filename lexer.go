@@ -1,7 +1,9 @@
-package main
+package water
 
 import (
+	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -14,8 +16,19 @@ type stateFn func(*lexer) stateFn
 // ========================================================
 
 type item struct {
-	t     itemType
-	value string
+	t          itemType
+	value      string
+	pos        Pos
+	start, end int       // offsets of the text of the item in the input
+	trivia     []Comment // comments that precede the item
+}
+
+// A comment of the code. Comments are skipped by the parser, but the
+// root of the tree keeps them to be able to reproduce the code when
+// formatting it.
+type Comment struct {
+	Pos  Pos
+	Text string // including the delimiters, and the datum of a #;
 }
 
 func (i item) String() string {
@@ -40,23 +53,25 @@ const (
 	itemEOF
 	itemLeftParen
 	itemRightParen
-	itemCall
 	itemNumber
 	itemString
 	itemBool
 	itemVar
+	itemQuote
+	itemDatumComment
 )
 
 var itemNames = map[itemType]string{
-	itemError:      "ERROR",
-	itemEOF:        "EOF",
-	itemLeftParen:  "(",
-	itemRightParen: ")",
-	itemCall:       "call",
-	itemNumber:     "number",
-	itemString:     "string",
-	itemBool:       "bool",
-	itemVar:        "variable",
+	itemError:        "ERROR",
+	itemEOF:          "EOF",
+	itemLeftParen:    "(",
+	itemRightParen:   ")",
+	itemNumber:       "number",
+	itemString:       "string",
+	itemBool:         "bool",
+	itemVar:          "variable",
+	itemQuote:        "quote",
+	itemDatumComment: "datum comment",
 }
 
 // ========================================================
@@ -66,24 +81,71 @@ type lexer struct {
 	state             stateFn
 	pos, start, width int
 	items             chan item
+	trivia            []Comment // comments waiting for the next item
+
+	// Track the lines of the input to compute the positions
+	source                   *Source
+	line, lineStart, scanned int
 }
 
-func NewLexer(input string) *lexer {
+func newLexer(name, input string) *lexer {
 	return &lexer{
-		input: input,
-		state: lexCode,
-		items: make(chan item),
+		input:  input,
+		state:  lexCode,
+		items:  make(chan item),
+		source: &Source{Name: name, Text: input},
+		line:   1,
 	}
 }
 
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, fmt.Sprintf(format, args...)}
+	return l.errorAt(l.start, format, args...)
+}
+
+// Report an error located in an offset of the current item.
+func (l *lexer) errorAt(offset int, format string, args ...interface{}) stateFn {
+	l.items <- item{t: itemError, value: fmt.Sprintf(format, args...), pos: l.position(offset)}
 	return nil
 }
 
 func (l *lexer) emit(t itemType) {
-	l.items <- item{t, l.input[l.start:l.pos]}
+	l.emitValue(t, l.input[l.start:l.pos])
+}
+
+// Emit an item whose value is different from its text, like the
+// strings once the escape sequences are replaced.
+func (l *lexer) emitValue(t itemType, value string) {
+	l.items <- item{
+		t:      t,
+		value:  value,
+		pos:    l.position(l.start),
+		start:  l.start,
+		end:    l.pos,
+		trivia: l.trivia,
+	}
 	l.start = l.pos
+	l.trivia = nil
+}
+
+// Save the scanned text as a comment for the next item.
+func (l *lexer) comment() {
+	c := Comment{Pos: l.position(l.start), Text: l.input[l.start:l.pos]}
+	l.trivia = append(l.trivia, c)
+	l.ignore()
+}
+
+// Return the position of an offset of the input. Offsets should be
+// requested in increasing order.
+func (l *lexer) position(offset int) Pos {
+	for ; l.scanned < offset; l.scanned++ {
+		if l.input[l.scanned] == '\n' {
+			l.line++
+			l.lineStart = l.scanned + 1
+		}
+	}
+
+	col := utf8.RuneCountInString(l.input[l.lineStart:offset]) + 1
+	return Pos{Source: l.source, Line: l.line, Col: col}
 }
 
 func (l *lexer) next() rune {
@@ -136,6 +198,13 @@ func (l *lexer) scanNumber() bool {
 		digits += "abcdefABCDEF"
 	}
 	l.acceptRun(digits)
+	if l.accept(".") {
+		l.acceptRun(digits)
+	}
+	if l.accept("eE") {
+		l.accept("+-")
+		l.acceptRun("0123456789")
+	}
 
 	if isAlphaNumeric(l.peek()) {
 		l.next()
@@ -154,7 +223,7 @@ func (l *lexer) emitItems() {
 
 func lexLeftParen(l *lexer) stateFn {
 	l.emit(itemLeftParen)
-	return lexCall
+	return lexCode
 }
 
 func lexRightParen(l *lexer) stateFn {
@@ -191,11 +260,41 @@ func lexCode(l *lexer) stateFn {
 	case r == '(':
 		return lexLeftParen
 
-	case r == '"' || r == '\'':
+	case r == '"':
 		l.backup()
 		return lexString
 
+	case r == '\'':
+		l.emit(itemQuote)
+		return lexCode
+
+	case r == '`':
+		// Reserved for the quasiquotes
+		return l.errorf("quasiquote is not supported")
+
+	case r == ';':
+		return lexLineComment
+
 	case r == '#':
+		switch l.peek() {
+		case '|':
+			return lexBlockComment
+
+		case '"':
+			l.backup()
+			return lexRawString
+
+		case ';':
+			// The parser skips the datum that follows
+			l.next()
+			l.emit(itemDatumComment)
+			return lexCode
+
+		case '!':
+			// Markers like #!optional are read as names
+			l.backup()
+			return lexVar
+		}
 		l.backup()
 		return lexBool
 
@@ -203,39 +302,40 @@ func lexCode(l *lexer) stateFn {
 		l.backup()
 		return lexVar
 	}
-
-	panic("not reached")
 }
 
-func lexCall(l *lexer) stateFn {
-	// Ignore all the spaces before the function name
+// Line comments start with a semicolon and end with the line.
+func lexLineComment(l *lexer) stateFn {
 	for {
-		r := l.next()
-		if !isSpace(r) {
-			l.backup()
+		if r := l.peek(); r == '\n' || r == eof {
 			break
 		}
+		l.next()
 	}
 
-	// Scan the name
-	r := l.next()
-	for !isSpace(r) && r != ')' {
-		r = l.next()
+	l.comment()
+	return lexCode
+}
 
-		if r == eof {
-			return l.errorf("eof not expected inside a method call")
+// Block comments are delimited by #| and |#, and they can be nested.
+func lexBlockComment(l *lexer) stateFn {
+	l.next() // get the |
+	for depth := 1; depth > 0; {
+		switch r := l.next(); {
+		case r == eof:
+			return l.errorf("eof not expected inside a block comment")
+
+		case r == '#' && l.peek() == '|':
+			l.next()
+			depth++
+
+		case r == '|' && l.peek() == '#':
+			l.next()
+			depth--
 		}
 	}
-	l.backup()
-
-	// If there's no name, it's an illegal call
-	if l.start == l.pos {
-		return l.errorf("illegal function name")
-	}
-
-	// Emit the correct token
-	l.emit(itemCall)
 
+	l.comment()
 	return lexCode
 }
 
@@ -249,19 +349,97 @@ func lexNumber(l *lexer) stateFn {
 	return lexCode
 }
 
+// Strings are delimited by double quotes and can span multiple lines.
+// The value of the item is the text with the escape sequences replaced.
 func lexString(l *lexer) stateFn {
-	delim := l.next()
+	var buf bytes.Buffer
+
+	l.next() // get the opening quote
 	for {
-		r := l.next()
-		if r == delim {
-			break
-		} else if r == eof {
-			l.errorf("eof not expected inside a string")
+		switch r := l.next(); r {
+		case '"':
+			l.emitValue(itemString, buf.String())
+			return lexCode
+
+		case eof:
+			return l.errorf("eof not expected inside a string")
+
+		case '\\':
+			offset := l.pos - l.width
+			if err := l.scanEscape(&buf); err != nil {
+				return l.errorAt(offset, "%s", err)
+			}
+
+		default:
+			buf.WriteRune(r)
 		}
 	}
+}
 
-	l.emit(itemString)
-	return lexCode
+// Scan the escape sequence that follows a backslash: \" \\ \n \t \r and
+// \u{hex} with the code point of an unicode character.
+func (l *lexer) scanEscape(buf *bytes.Buffer) error {
+	switch r := l.next(); r {
+	case '"', '\\':
+		buf.WriteRune(r)
+	case 'n':
+		buf.WriteByte('\n')
+	case 't':
+		buf.WriteByte('\t')
+	case 'r':
+		buf.WriteByte('\r')
+
+	case 'u':
+		if l.next() != '{' {
+			return fmt.Errorf("expected { after \\u in the string")
+		}
+		start := l.pos
+		for isHexDigit(l.peek()) {
+			l.next()
+		}
+		digits := l.input[start:l.pos]
+		if l.next() != '}' || digits == "" || len(digits) > 6 {
+			return fmt.Errorf("expected 1 to 6 hex digits between the braces of \\u{...}")
+		}
+
+		code, _ := strconv.ParseUint(digits, 16, 32)
+		if code > unicode.MaxRune || (code >= 0xd800 && code <= 0xdfff) {
+			return fmt.Errorf("invalid unicode code point in the string: \\u{%s}", digits)
+		}
+		buf.WriteRune(rune(code))
+
+	case eof:
+		return fmt.Errorf("eof not expected inside a string")
+
+	default:
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("unknown escape sequence in the string")
+		}
+		return fmt.Errorf("unknown escape sequence in the string: \\%c", r)
+	}
+
+	return nil
+}
+
+// Raw strings are delimited by #" and "#, and their content is taken
+// literally, including the quotes, the backslashes and the newlines.
+func lexRawString(l *lexer) stateFn {
+	l.next() // get the #
+	l.next() // get the opening quote
+	start := l.pos
+	for {
+		switch l.next() {
+		case '"':
+			if l.peek() == '#' {
+				l.next()
+				l.emitValue(itemString, l.input[start:l.pos-2])
+				return lexCode
+			}
+
+		case eof:
+			return l.errorf("eof not expected inside a raw string")
+		}
+	}
 }
 
 func lexBool(l *lexer) stateFn {
@@ -275,7 +453,7 @@ func lexBool(l *lexer) stateFn {
 func lexVar(l *lexer) stateFn {
 	// Scan the name
 	r := l.next()
-	for !isSpace(r) && r != eof && r != ')' {
+	for !isSpace(r) && r != eof && r != ')' && r != ';' {
 		r = l.next()
 	}
 	l.backup()
@@ -290,6 +468,10 @@ func lexVar(l *lexer) stateFn {
 	return lexCode
 }
 
+func isHexDigit(r rune) bool {
+	return strings.ContainsRune("0123456789abcdefABCDEF", r)
+}
+
 func isSpace(r rune) bool {
 	switch r {
 	case ' ', '\n', '\t', '\r':
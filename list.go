@@ -0,0 +1,182 @@
+package water
+
+import (
+	"bytes"
+	"fmt"
+	"unicode"
+)
+
+// A cons cell. The empty list is represented by a nil *Pair, so a proper
+// list is a chain of pairs whose last Cdr is (*Pair)(nil).
+type Pair struct {
+	Car, Cdr Value
+}
+
+func (p *Pair) String() string {
+	if p == nil {
+		return "()"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("(")
+
+	var v Value = p
+	for first := true; ; first = false {
+		pair, ok := v.(*Pair)
+		if !ok {
+			// Improper list, print the dotted tail
+			buf.WriteString(" . ")
+			buf.WriteString(formatDatum(v))
+			break
+		}
+		if pair == nil {
+			break
+		}
+
+		if !first {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(formatDatum(pair.Car))
+
+		v = pair.Cdr
+	}
+
+	buf.WriteString(")")
+	return buf.String()
+}
+
+func (p *Pair) value() {}
+
+// Format a value that appears inside a list. Strings are quoted to
+// differentiate them from the rest of values.
+func formatDatum(v Value) string {
+	if s, ok := v.(String); ok {
+		return quoteString(string(s))
+	}
+	return v.String()
+}
+
+// Quote a string with the same escape sequences accepted by the lexer,
+// so it can be read back.
+func quoteString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&buf, "\\u{%x}", r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// ========================================================
+
+// The value of a quoted name.
+type Symbol string
+
+func (v Symbol) String() string {
+	return string(v)
+}
+
+func (v Symbol) value() {}
+
+// ========================================================
+
+func list(args ...Value) *Pair {
+	var l *Pair
+	for i := len(args) - 1; i >= 0; i-- {
+		l = &Pair{Car: args[i], Cdr: l}
+	}
+	return l
+}
+
+func listFunc(args ...Value) (Value, error) {
+	return list(args...), nil
+}
+
+func cons(a, b Value) (Value, error) {
+	return &Pair{Car: a, Cdr: b}, nil
+}
+
+func car(v Value) (Value, error) {
+	p, ok := v.(*Pair)
+	if !ok || p == nil {
+		return nil, fmt.Errorf("expected a non-empty list, got %s", formatDatum(v))
+	}
+	return p.Car, nil
+}
+
+func cdr(v Value) (Value, error) {
+	p, ok := v.(*Pair)
+	if !ok || p == nil {
+		return nil, fmt.Errorf("expected a non-empty list, got %s", formatDatum(v))
+	}
+	return p.Cdr, nil
+}
+
+func null(v Value) (Value, error) {
+	p, ok := v.(*Pair)
+	return Bool(ok && p == nil), nil
+}
+
+func length(v Value) (Value, error) {
+	items, err := listItems(v)
+	if err != nil {
+		return nil, err
+	}
+	return Int(len(items)), nil
+}
+
+func appendLists(args ...Value) (Value, error) {
+	if len(args) == 0 {
+		return (*Pair)(nil), nil
+	}
+
+	// The last argument is shared with the result, the rest of them
+	// are copied in order
+	items := []Value{}
+	for _, arg := range args[:len(args)-1] {
+		l, err := listItems(arg)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, l...)
+	}
+
+	res := args[len(args)-1]
+	for i := len(items) - 1; i >= 0; i-- {
+		res = &Pair{Car: items[i], Cdr: res}
+	}
+
+	return res, nil
+}
+
+// Return the elements of a proper list as a slice.
+func listItems(v Value) ([]Value, error) {
+	items := []Value{}
+	for {
+		p, ok := v.(*Pair)
+		if !ok {
+			return nil, fmt.Errorf("not a proper list: %s", formatDatum(v))
+		}
+		if p == nil {
+			return items, nil
+		}
+
+		items = append(items, p.Car)
+		v = p.Cdr
+	}
+}
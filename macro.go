@@ -0,0 +1,411 @@
+package water
+
+import (
+	"fmt"
+)
+
+// Macros are defined with syntax-rules: each rule has a pattern that
+// matches the form using the macro and a template that it's expanded
+// to replace it:
+//
+//     (define-syntax swap
+//       (syntax-rules ()
+//         ((swap a b) ((lambda (tmp) (set a b) (set b tmp)) a))))
+//
+// Variables bound by lambdas of the template are renamed, so they
+// don't capture the variables of the code that uses the macro.
+type macro struct {
+	name     string
+	literals map[string]bool
+	rules    []*syntaxRule
+}
+
+type syntaxRule struct {
+	pattern  *ListNode
+	template Node
+}
+
+type macros map[string]*macro
+
+const (
+	ellipsis = "..."
+
+	// Limit of macros expanding to other macros, to detect the
+	// infinite recursions
+	maxExpansionDepth = 1000
+)
+
+func isEllipsis(n Node) bool {
+	v, ok := n.(*VarNode)
+	return ok && v.Name == ellipsis
+}
+
+// Values matched by the pattern variables. Variables followed by an
+// ellipsis match a sequence of values instead of a single one.
+type binding struct {
+	node  Node
+	items []*binding
+}
+
+type bindings map[string]*binding
+
+// A symbol introduced by an expansion of a macro.
+type markedName struct {
+	name string
+	mark int
+}
+
+// ========================================================
+
+func (p *parser) parseDefineSyntax(l *ListNode) {
+	if len(l.Nodes) != 3 {
+		p.errorAt(l.Pos, "bad define-syntax syntax, expected (define-syntax name (syntax-rules ...))")
+	}
+
+	name, ok := l.Nodes[1].(*VarNode)
+	if !ok {
+		p.errorAt(l.Nodes[1].Position(), "expected a macro name in define-syntax")
+	}
+
+	spec, ok := l.Nodes[2].(*ListNode)
+	if !ok || len(spec.Nodes) < 2 {
+		p.errorAt(l.Nodes[2].Position(), "expected a syntax-rules specification in define-syntax")
+	}
+	if head, ok := spec.Nodes[0].(*VarNode); !ok || head.Name != "syntax-rules" {
+		p.errorAt(spec.Pos, "only syntax-rules macros are supported")
+	}
+
+	m := &macro{name: name.Name, literals: make(map[string]bool)}
+
+	literals, ok := spec.Nodes[1].(*ListNode)
+	if !ok {
+		p.errorAt(spec.Nodes[1].Position(), "expected a list of literals in syntax-rules")
+	}
+	for _, d := range literals.Nodes {
+		lit, ok := d.(*VarNode)
+		if !ok {
+			p.errorAt(d.Position(), "expected a symbol in the syntax-rules literals")
+		}
+		m.literals[lit.Name] = true
+	}
+
+	for _, d := range spec.Nodes[2:] {
+		rule, ok := d.(*ListNode)
+		if !ok || len(rule.Nodes) != 2 {
+			p.errorAt(d.Position(), "bad syntax rule, expected (pattern template)")
+		}
+
+		pattern, ok := rule.Nodes[0].(*ListNode)
+		if !ok || len(pattern.Nodes) == 0 {
+			p.errorAt(rule.Nodes[0].Position(), "the pattern of a syntax rule should be a list")
+		}
+		p.checkPattern(pattern)
+
+		m.rules = append(m.rules, &syntaxRule{pattern: pattern, template: rule.Nodes[1]})
+	}
+
+	p.macros[m.name] = m
+}
+
+// Check that the ellipsis of a pattern follow an element, and that
+// there's only one of them in each list.
+func (p *parser) checkPattern(pattern *ListNode) {
+	found := false
+	for i, d := range pattern.Nodes {
+		if isEllipsis(d) {
+			if i == 0 || found {
+				p.errorAt(d.Position(), "misplaced ellipsis in the syntax rule pattern")
+			}
+			found = true
+		}
+
+		if l, ok := d.(*ListNode); ok {
+			p.checkPattern(l)
+		}
+	}
+
+	if pattern.Tail != nil && found {
+		p.errorAt(pattern.Pos, "cannot use an ellipsis in a dotted pattern")
+	}
+	if l, ok := pattern.Tail.(*ListNode); ok {
+		p.checkPattern(l)
+	}
+}
+
+// Replace a form using a macro with its expansion.
+func (p *parser) parseMacro(m *macro, l *ListNode) Node {
+	for _, rule := range m.rules {
+		// The keyword of the macro is ignored in the patterns
+		b := make(bindings)
+		pattern := &ListNode{Pos: rule.pattern.Pos, Nodes: rule.pattern.Nodes[1:], Tail: rule.pattern.Tail}
+		form := &ListNode{Pos: l.Pos, Nodes: l.Nodes[1:]}
+		if !m.match(pattern, form, b) {
+			continue
+		}
+
+		p.depth++
+		if p.depth > maxExpansionDepth {
+			p.errorAt(l.Pos, "too many nested expansions of the macro %s", m.name)
+		}
+
+		p.expansion++
+		n := p.parseExpression(p.expand(rule.template, b, l.Pos, p.expansion))
+
+		p.depth--
+		return n
+	}
+
+	p.errorAt(l.Pos, "no syntax rule of the macro %s matches the form", m.name)
+	panic("not reached")
+}
+
+func (m *macro) match(pattern, form Node, b bindings) bool {
+	switch pattern := pattern.(type) {
+	case *VarNode:
+		if pattern.Name == "_" {
+			return true
+		}
+
+		if m.literals[pattern.Name] {
+			v, ok := form.(*VarNode)
+			return ok && v.Name == pattern.Name
+		}
+
+		b[pattern.Name] = &binding{node: form}
+		return true
+
+	case *ListNode:
+		l, ok := form.(*ListNode)
+		if !ok {
+			return false
+		}
+		if pattern.Tail == nil {
+			return l.Tail == nil && m.matchList(pattern.Nodes, l.Nodes, b)
+		}
+
+		// The tail of a dotted pattern matches the rest of the form
+		n := len(pattern.Nodes)
+		if len(l.Nodes) < n || !m.matchList(pattern.Nodes, l.Nodes[:n], b) {
+			return false
+		}
+		var rest Node = &ListNode{Pos: l.Pos, Nodes: l.Nodes[n:], Tail: l.Tail}
+		if len(l.Nodes) == n && l.Tail != nil {
+			rest = l.Tail
+		}
+		return m.match(pattern.Tail, rest, b)
+
+	case *NumberNode:
+		n, ok := form.(*NumberNode)
+		return ok && numberValue(n).String() == numberValue(pattern).String()
+
+	case *StringNode:
+		s, ok := form.(*StringNode)
+		return ok && s.Text == pattern.Text
+
+	case *BoolNode:
+		v, ok := form.(*BoolNode)
+		return ok && v.Value == pattern.Value
+	}
+
+	return false
+}
+
+func (m *macro) matchList(patterns, forms []Node, b bindings) bool {
+	for i, pattern := range patterns {
+		if i+1 < len(patterns) && isEllipsis(patterns[i+1]) {
+			// The ellipsis takes all the forms except the ones needed
+			// by the patterns that follow it
+			n := len(forms) - i - (len(patterns) - i - 2)
+			if n < 0 {
+				return false
+			}
+
+			items := make([]bindings, n)
+			for j := range items {
+				items[j] = make(bindings)
+				if !m.match(pattern, forms[i+j], items[j]) {
+					return false
+				}
+			}
+
+			for _, name := range m.patternVars(pattern) {
+				seq := &binding{items: make([]*binding, n)}
+				for j := range items {
+					seq.items[j] = items[j][name]
+				}
+				b[name] = seq
+			}
+
+			return m.matchList(patterns[i+2:], forms[i+n:], b)
+		}
+
+		if i >= len(forms) || !m.match(pattern, forms[i], b) {
+			return false
+		}
+	}
+
+	return len(forms) == len(patterns)
+}
+
+// Return the names of the variables bound by a pattern.
+func (m *macro) patternVars(pattern Node) []string {
+	switch pattern := pattern.(type) {
+	case *VarNode:
+		if pattern.Name != "_" && pattern.Name != ellipsis && !m.literals[pattern.Name] {
+			return []string{pattern.Name}
+		}
+
+	case *ListNode:
+		names := []string{}
+		for _, d := range pattern.Nodes {
+			names = append(names, m.patternVars(d)...)
+		}
+		if pattern.Tail != nil {
+			names = append(names, m.patternVars(pattern.Tail)...)
+		}
+		return names
+	}
+
+	return nil
+}
+
+// Build the expansion of a template with the values of the pattern
+// variables. The new nodes are located in the form using the macro,
+// and the symbols they introduce are marked with the expansion.
+func (p *parser) expand(template Node, b bindings, pos Pos, mark int) Node {
+	switch t := template.(type) {
+	case *VarNode:
+		if v, ok := b[t.Name]; ok {
+			if v.items != nil {
+				p.errorAt(pos, "pattern variable %s should be followed by an ellipsis in the template", t.Name)
+			}
+			return v.node
+		}
+
+		name := &VarNode{Pos: pos, Name: t.Name}
+		p.marks[name] = mark
+		return name
+
+	case *ListNode:
+		l := &ListNode{Pos: pos, Nodes: make([]Node, 0)}
+		for i := 0; i < len(t.Nodes); i++ {
+			d := t.Nodes[i]
+			if i+1 < len(t.Nodes) && isEllipsis(t.Nodes[i+1]) {
+				l.Nodes = append(l.Nodes, p.expandEllipsis(d, b, pos, mark)...)
+				i++
+				continue
+			}
+
+			l.Nodes = append(l.Nodes, p.expand(d, b, pos, mark))
+		}
+
+		// Splice the expansion of the tail if it's a list
+		if t.Tail != nil {
+			tail := p.expand(t.Tail, b, pos, mark)
+			if rest, ok := tail.(*ListNode); ok {
+				l.Nodes = append(l.Nodes, rest.Nodes...)
+				l.Tail = rest.Tail
+			} else {
+				l.Tail = tail
+			}
+		}
+		return l
+	}
+
+	return template
+}
+
+// Expand a template followed by an ellipsis once for each value of the
+// sequences matched by its variables.
+func (p *parser) expandEllipsis(template Node, b bindings, pos Pos, mark int) []Node {
+	n := -1
+	seqs := map[string][]*binding{}
+	for _, name := range templateVars(template) {
+		v, ok := b[name]
+		if !ok || v.items == nil {
+			continue
+		}
+
+		if n >= 0 && len(v.items) != n {
+			p.errorAt(pos, "pattern variables of the same ellipsis matched a different number of forms")
+		}
+		n = len(v.items)
+		seqs[name] = v.items
+	}
+	if n < 0 {
+		p.errorAt(pos, "ellipsis without pattern variables in the template")
+	}
+
+	nodes := make([]Node, n)
+	for i := range nodes {
+		inner := make(bindings, len(b))
+		for name, v := range b {
+			inner[name] = v
+		}
+		for name, items := range seqs {
+			inner[name] = items[i]
+		}
+
+		nodes[i] = p.expand(template, inner, pos, mark)
+	}
+	return nodes
+}
+
+func templateVars(template Node) []string {
+	switch t := template.(type) {
+	case *VarNode:
+		return []string{t.Name}
+
+	case *ListNode:
+		names := []string{}
+		for _, d := range t.Nodes {
+			names = append(names, templateVars(d)...)
+		}
+		if t.Tail != nil {
+			names = append(names, templateVars(t.Tail)...)
+		}
+		return names
+	}
+
+	return nil
+}
+
+// ========================================================
+
+// Give fresh names to the variables introduced by a macro expansion that
+// are bound by a lambda, returning the nodes of the new names. The scope
+// of the names should be closed with unbind.
+func (p *parser) bind(names []*VarNode) []Node {
+	scope := make(map[markedName]string)
+	args := make([]Node, len(names))
+	for i, name := range names {
+		mark, ok := p.marks[name]
+		if !ok {
+			args[i] = name
+			continue
+		}
+
+		// The space makes a name that the code cannot use
+		renamed := fmt.Sprintf("%s %d", name.Name, mark)
+		scope[markedName{name.Name, mark}] = renamed
+		args[i] = &VarNode{Pos: name.Pos, Name: renamed}
+	}
+
+	p.scopes = append(p.scopes, scope)
+	return args
+}
+
+func (p *parser) unbind() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// Return the name of a variable introduced by a macro expansion in the
+// current scope.
+func (p *parser) resolve(name string, mark int) string {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if renamed, ok := p.scopes[i][markedName{name, mark}]; ok {
+			return renamed
+		}
+	}
+	return name
+}
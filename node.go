@@ -1,17 +1,83 @@
-package main
+package water
 
 import (
 	"fmt"
+	"math/big"
+	"strings"
+	"sync"
 )
 
 type Node interface {
 	String() string
+	Position() Pos
+}
+
+// ========================================================
+
+type Source struct {
+	Name string
+	Text string
+}
+
+// Position of a token or a node in the source code. Lines and
+// columns start at 1.
+type Pos struct {
+	Source    *Source
+	Line, Col int
+}
+
+func (p Pos) Position() Pos {
+	return p
+}
+
+func (p Pos) String() string {
+	if p.Source == nil {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Source.Name, p.Line, p.Col)
+}
+
+// Return the line of source code of the position with a marker
+// under the column.
+func (p Pos) Snippet() string {
+	if p.Source == nil || p.Line < 1 {
+		return ""
+	}
+
+	lines := strings.Split(p.Source.Text, "\n")
+	if p.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[p.Line-1], "\r")
+
+	// Keep the tabs in the marker line to align it correctly
+	marker := make([]rune, 0)
+	for i, r := range []rune(line) {
+		if i >= p.Col-1 {
+			break
+		}
+
+		if r == '\t' {
+			marker = append(marker, '\t')
+		} else {
+			marker = append(marker, ' ')
+		}
+	}
+
+	return fmt.Sprintf("\t%s\n\t%s^", line, string(marker))
 }
 
 // ========================================================
 
 type ListNode struct {
+	Pos
+
 	Nodes []Node
+	Tail  Node // last cdr of a dotted list like (a b . c), nil otherwise
+
+	// Comments of the whole code in the root of the tree, in the
+	// same order they appear
+	Comments []Comment
 }
 
 func (n *ListNode) String() string {
@@ -21,23 +87,29 @@ func (n *ListNode) String() string {
 // ========================================================
 
 type CallNode struct {
-	Name string
-	Args []Node
+	Pos
+
+	Callee Node
+	Args   []Node
 }
 
 func (n *CallNode) String() string {
-	return fmt.Sprintf("call node to function %s with %d args", n.Name, len(n.Args))
+	return fmt.Sprintf("call node to %s with %d args", n.Callee, len(n.Args))
 }
 
 // ========================================================
 
 type NumberNode struct {
+	Pos
+
 	Text string
 
-	IsInt, IsUint bool
+	IsInt, IsUint, IsBigInt, IsFloat bool
 
-	Int64  int64
-	Uint64 uint64
+	Int64   int64
+	Uint64  uint64
+	BigInt  *big.Int
+	Float64 float64
 }
 
 func (n *NumberNode) String() string {
@@ -47,6 +119,8 @@ func (n *NumberNode) String() string {
 // ========================================================
 
 type StringNode struct {
+	Pos
+
 	Text string
 }
 
@@ -57,6 +131,8 @@ func (n *StringNode) String() string {
 // ========================================================
 
 type VarNode struct {
+	Pos
+
 	Name string
 }
 
@@ -67,6 +143,8 @@ func (n *VarNode) String() string {
 // ========================================================
 
 type DefineNode struct {
+	Pos
+
 	Variable *VarNode
 	Value    Node
 }
@@ -78,6 +156,8 @@ func (n *DefineNode) String() string {
 // ========================================================
 
 type SetNode struct {
+	Pos
+
 	Variable *VarNode
 	Value    Node
 }
@@ -89,9 +169,11 @@ func (n *SetNode) String() string {
 // ========================================================
 
 type IfNode struct {
+	Pos
+
 	Test   Node
-	Conseq Node
-	Alt    Node
+	Conseq Node // nil if the branch doesn't have any value
+	Alt    Node // nil if the branch doesn't have any value
 }
 
 func (n *IfNode) String() string {
@@ -101,6 +183,8 @@ func (n *IfNode) String() string {
 // ========================================================
 
 type BoolNode struct {
+	Pos
+
 	Value bool
 }
 
@@ -111,6 +195,8 @@ func (n *BoolNode) String() string {
 // ========================================================
 
 type BeginNode struct {
+	Pos
+
 	Nodes []Node
 }
 
@@ -121,10 +207,168 @@ func (n *BeginNode) String() string {
 // ========================================================
 
 type LambdaNode struct {
-	Args []Node // always a *VarNode
-	Body Node   // always a *CallNode
+	Pos
+
+	Args     []Node   // always a *VarNode, the optional ones at the end
+	Optional int      // number of optional arguments in Args
+	Defaults []Node   // one per optional argument, nil if it has no default
+	Rest     *VarNode // receives the extra arguments as a list, or nil
+	Body     Node     // a *BeginNode if there are multiple expressions
+
+	defines bodyDefines
 }
 
 func (n *LambdaNode) String() string {
 	return fmt.Sprintf("lambda node with arity %d", len(n.Args))
 }
+
+// ========================================================
+
+type QuoteNode struct {
+	Pos
+
+	Datum Node // literals, *VarNode for symbols and *ListNode for lists
+
+	once  sync.Once
+	value Value // built from the datum the first time it's evaluated
+}
+
+func (n *QuoteNode) String() string {
+	return fmt.Sprintf("quote node of %s", n.Datum)
+}
+
+// ========================================================
+
+// Local variables bound in a new environment nested inside the current
+// one. let* and named lets are built with them too.
+type LetNode struct {
+	Pos
+
+	Rec    bool   // letrec: the values are evaluated in the new environment
+	Vars   []Node // always a *VarNode
+	Values []Node
+	Body   Node // a *BeginNode if there are multiple expressions
+
+	defines bodyDefines
+}
+
+func (n *LetNode) String() string {
+	return fmt.Sprintf("let node with %d variables", len(n.Vars))
+}
+
+// ========================================================
+
+// Evaluate the expressions in order until one of them is false,
+// returning its value, or the value of the last one.
+type AndNode struct {
+	Pos
+
+	Nodes []Node
+}
+
+func (n *AndNode) String() string {
+	return fmt.Sprintf("and node with %d expressions", len(n.Nodes))
+}
+
+// ========================================================
+
+// Evaluate the expressions in order until one of them is true,
+// returning its value, or the value of the last one.
+type OrNode struct {
+	Pos
+
+	Nodes []Node
+}
+
+func (n *OrNode) String() string {
+	return fmt.Sprintf("or node with %d expressions", len(n.Nodes))
+}
+
+// ========================================================
+
+type CaseNode struct {
+	Pos
+
+	Key     Node
+	Clauses []*CaseClause
+	Else    Node // nil if there's no else clause
+}
+
+func (n *CaseNode) String() string {
+	return fmt.Sprintf("case node with %d clauses", len(n.Clauses))
+}
+
+// Body executed when the key is one of the data of the clause.
+type CaseClause struct {
+	Datums []Node // literals and *VarNode for symbols
+	Body   Node
+}
+
+// ========================================================
+
+// A loop that binds the variables to their initial values and executes
+// the body, updating the variables with their steps in a new environment,
+// until the test is true.
+type DoNode struct {
+	Pos
+
+	Vars   []Node // always a *VarNode
+	Inits  []Node
+	Steps  []Node // nil for the variables without step
+	Test   Node
+	Result Node // nil if there are no result expressions
+	Body   Node // nil if there are no expressions in the body
+
+	defines bodyDefines
+}
+
+func (n *DoNode) String() string {
+	return fmt.Sprintf("do node with %d variables", len(n.Vars))
+}
+
+// ========================================================
+
+type WhileNode struct {
+	Pos
+
+	Test Node
+	Body Node // nil if there are no expressions in the body
+
+	defines bodyDefines
+}
+
+func (n *WhileNode) String() string {
+	return fmt.Sprintf("while node")
+}
+
+// ========================================================
+
+// Execute the body with the variable bound to the integers from zero
+// to the count, excluding it.
+type DotimesNode struct {
+	Pos
+
+	Var    *VarNode
+	Count  Node
+	Result Node // nil if there's no result expression
+	Body   Node // nil if there are no expressions in the body
+
+	defines bodyDefines
+}
+
+func (n *DotimesNode) String() string {
+	return fmt.Sprintf("dotimes node for %s", n.Var)
+}
+
+// ========================================================
+
+// Exit the innermost loop, with the value of the expression.
+type BreakNode struct {
+	Pos
+
+	Value Node // nil if the loop shouldn't have any value
+}
+
+func (n *BreakNode) String() string {
+	return fmt.Sprintf("break node")
+}
@@ -1,34 +1,48 @@
-package main
+package water
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"runtime"
 	"strconv"
+	"strings"
 )
 
-func Parse(r io.Reader) (l *ListNode, err error) {
+func Parse(name string, r io.Reader) (*ListNode, error) {
+	return parse(name, r, make(macros))
+}
+
+// Parse the code with a table of macros, that it's extended with the
+// macros defined by the code.
+func parse(name string, r io.Reader, m macros) (l *ListNode, err error) {
 	contents, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
 	p := &parser{
-		Root: new(ListNode),
-		lex:  NewLexer(string(contents)),
+		Root:   new(ListNode),
+		lex:    newLexer(name, string(contents)),
+		macros: m,
+		marks:  make(map[*VarNode]int),
 	}
 
 	defer p.recover(&err)
 	go p.lex.emitItems()
 
 	for {
+		p.skipDatumComments()
 		item := p.peek()
 		if item.t == itemEOF {
 			break
 		}
 
-		p.Root.Nodes = append(p.Root.Nodes, p.parseExpression())
+		if n := p.parseTopLevel(p.parseDatum()); n != nil {
+			p.Root.Nodes = append(p.Root.Nodes, n)
+		}
 	}
 
 	l = p.Root
@@ -36,8 +50,40 @@ func Parse(r io.Reader) (l *ListNode, err error) {
 	return
 }
 
+// Report if the source code ends in the middle of an expression,
+// with unbalanced parens or an unterminated string.
+func Incomplete(src string) bool {
+	l := newLexer("", src)
+	go l.emitItems()
+
+	depth := 0
+	last := itemEOF
+	for item := range l.items {
+		switch item.t {
+		case itemLeftParen:
+			depth++
+
+		case itemRightParen:
+			depth--
+
+		case itemError:
+			// Errors at the end of the input are unterminated tokens
+			return l.pos >= len(src)
+
+		case itemEOF:
+			continue
+		}
+		last = item.t
+	}
+
+	return depth > 0 || last == itemQuote || last == itemDatumComment
+}
+
 // ========================================================
 
+// The code is parsed in two steps: the tokens are read as data (lists,
+// symbols and literals) and then the data it's analyzed to build the
+// nodes of the expressions, expanding the macros.
 type parser struct {
 	Root *ListNode
 
@@ -45,6 +91,19 @@ type parser struct {
 
 	token  item
 	stored bool
+
+	macros macros
+
+	// Symbols introduced by the macro expansions and the local
+	// variables they bind
+	marks     map[*VarNode]int
+	expansion int
+	depth     int
+	scopes    []map[markedName]string
+
+	// Number of loops that enclose the current expression inside
+	// the current function
+	loops int
 }
 
 func (p *parser) expect(expected itemType, context string) item {
@@ -73,67 +132,137 @@ func (p *parser) next() item {
 	}
 
 	p.token = <-p.lex.items
+	if p.token.t == itemError {
+		p.errorf("%s", p.token.value)
+	}
+	p.Root.Comments = append(p.Root.Comments, p.token.trivia...)
 	return p.token
 }
 
+// Abort the parsing with an error located in the last read token.
 func (p *parser) errorf(format string, args ...interface{}) {
+	p.errorAt(p.token.pos, format, args...)
+}
+
+// Abort the parsing with an error located in a node.
+func (p *parser) errorAt(pos Pos, format string, args ...interface{}) {
 	p.Root = nil
-	panic(fmt.Sprintf(format, args...))
+	panic(&ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)})
 }
 
 func (p *parser) recover(errp *error) {
 	if e := recover(); e != nil {
-		*errp = fmt.Errorf("%s", e)
 		if _, ok := e.(runtime.Error); ok {
 			panic(e)
 		}
+
+		// Consume the rest of the items to let the lexer finish
+		for range p.lex.items {
+		}
+
+		if err, ok := e.(*ParseError); ok {
+			*errp = err
+		} else {
+			*errp = fmt.Errorf("%s", e)
+		}
 	}
 }
 
-func (p *parser) parseCall() Node {
-	p.expect(itemLeftParen, "call")
+// ========================================================
 
-	name := p.peek().value
+// Parse a literal piece of data. Lists are returned as a *ListNode
+// and symbols as a *VarNode.
+func (p *parser) parseDatum() Node {
+	p.skipDatumComments()
 
-	// Parse some call-like structures that are treated in a
-	// different way by the lang
-	switch name {
-	case "define":
-		return p.parseDefine()
+	switch item := p.peek(); item.t {
+	case itemNumber:
+		return p.parseNumber()
 
-	case "set":
-		return p.parseSet()
+	case itemString:
+		return p.parseString()
 
-	case "if":
-		return p.parseIf()
+	case itemBool:
+		return p.parseBool()
 
-	case "begin":
-		return p.parseBegin()
+	case itemVar:
+		item := p.expect(itemVar, "var")
+		return &VarNode{Pos: item.pos, Name: item.value}
 
-	case "lambda":
-		return p.parseLambda()
-	}
+	case itemQuote:
+		p.next()
+		quote := &VarNode{Pos: item.pos, Name: "quote"}
+		return &ListNode{Pos: item.pos, Nodes: []Node{quote, p.parseDatum()}}
 
-	c := &CallNode{
-		Name: p.next().value,
-		Args: make([]Node, 0),
-	}
-	for {
-		if p.peek().t == itemRightParen {
-			p.next()
-			return c
+	case itemLeftParen:
+		p.next()
+
+		l := &ListNode{Pos: item.pos, Nodes: make([]Node, 0)}
+		for {
+			p.skipDatumComments()
+			item := p.peek()
+			if item.t == itemEOF {
+				p.errorf("unexpected EOF while reading a list")
+			}
+			if item.t == itemRightParen {
+				break
+			}
+
+			if item.t == itemVar && item.value == "." {
+				if len(l.Nodes) == 0 {
+					p.errorf("expected an element before the dot of the list")
+				}
+				p.next()
+				l.Tail = p.parseDatum()
+				p.expect(itemRightParen, "dotted list")
+				return l
+			}
+
+			l.Nodes = append(l.Nodes, p.parseDatum())
 		}
+		p.expect(itemRightParen, "list")
+
+		return l
 
-		c.Args = append(c.Args, p.parseExpression())
+	default:
+		p.errorf("cannot use this kind of value as a datum: %s", item)
 	}
 
 	panic("not reached")
 }
 
+// Skip the data commented with #;, saving their text as a comment.
+func (p *parser) skipDatumComments() {
+	for p.peek().t == itemDatumComment {
+		start := p.next()
+		if t := p.peek().t; t == itemRightParen || t == itemEOF {
+			p.errorf("expected a datum after the datum comment")
+		}
+
+		// The comments inside the datum are already part of its text
+		n := len(p.Root.Comments)
+		p.parseDatum()
+		p.Root.Comments = append(p.Root.Comments[:n], Comment{
+			Pos:  start.pos,
+			Text: p.lex.input[start.start:p.token.end],
+		})
+	}
+}
+
+// Numbers with a decimal point or an exponent. The rest of them are
+// integers, and they cannot be read as floats when they're invalid,
+// like 08 that it's not an octal number.
+func isFloatSyntax(s string) bool {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return false
+	}
+	return strings.ContainsAny(s, ".eE")
+}
+
 func (p *parser) parseNumber() Node {
 	item := p.expect(itemNumber, "number")
 
-	n := &NumberNode{Text: item.value}
+	n := &NumberNode{Pos: item.pos, Text: item.value}
 
 	sign := 1
 	if item.value[0] == '+' || item.value[0] == '-' {
@@ -161,7 +290,29 @@ func (p *parser) parseNumber() Node {
 		}
 	}
 
-	if !n.IsUint || !n.IsInt {
+	if n.IsInt {
+		n.IsFloat = true
+		n.Float64 = float64(n.Int64)
+	} else if b, ok := new(big.Int).SetString(item.value, 0); ok {
+		// Integers too large to fit in an int64
+		b.Mul(b, big.NewInt(int64(sign)))
+		if b.IsInt64() {
+			n.IsInt = true
+			n.Int64 = b.Int64()
+		} else {
+			n.IsBigInt = true
+			n.BigInt = b
+		}
+	} else if isFloatSyntax(item.value) {
+		// Numbers too large for a float are read as an infinity
+		f, err := strconv.ParseFloat(item.value, 64)
+		if err == nil || errors.Is(err, strconv.ErrRange) {
+			n.IsFloat = true
+			n.Float64 = float64(sign) * f
+		}
+	}
+
+	if !n.IsInt && !n.IsBigInt && !n.IsFloat {
 		p.errorf("illegal number syntax: %s", item.value)
 	}
 
@@ -171,149 +322,751 @@ func (p *parser) parseNumber() Node {
 func (p *parser) parseString() Node {
 	item := p.expect(itemString, "string")
 
-	n := new(StringNode)
+	// The lexer already replaced the escape sequences
+	return &StringNode{Pos: item.pos, Text: item.value}
+}
 
-	var err error
-	n.Text, err = strconv.Unquote(item.value)
-	if err != nil {
-		p.errorf("cannot unquote the string literal: %s", err)
+func (p *parser) parseBool() Node {
+	it := p.expect(itemBool, "bool")
+
+	if it.value == "#t" || it.value == "#f" {
+		return &BoolNode{Pos: it.pos, Value: it.value == "#t"}
 	}
 
-	return n
+	p.errorf("incorrect boolean value, should be #t or #f: %s", it)
+	panic("not reached")
+}
+
+// ========================================================
+
+// Analyze a top-level piece of data. Macro definitions are only allowed
+// here, and they don't produce any node.
+func (p *parser) parseTopLevel(d Node) Node {
+	if l, ok := d.(*ListNode); ok && len(l.Nodes) > 0 {
+		if head, ok := l.Nodes[0].(*VarNode); ok && head.Name == "define-syntax" {
+			p.parseDefineSyntax(l)
+			return nil
+		}
+	}
+
+	return p.parseExpression(d)
+}
+
+func (p *parser) parseExpression(d Node) Node {
+	switch d := d.(type) {
+	case *NumberNode, *StringNode, *BoolNode:
+		return d
+
+	case *VarNode:
+		return p.parseVar(d)
+
+	case *ListNode:
+		if d.Tail != nil {
+			p.errorAt(d.Pos, "cannot use a dotted list as a expression")
+		}
+		return p.parseCall(d)
+	}
+
+	p.errorAt(d.Position(), "cannot use this kind of value as a expression: %s", d)
+	panic("not reached")
 }
 
-func (p *parser) parseDefine() Node {
-	p.expect(itemCall, "define")
-	name := p.parseVar(false)
-	init := p.parseExpression()
-	p.expect(itemRightParen, "define")
+func (p *parser) parseCall(l *ListNode) Node {
+	if len(l.Nodes) == 0 {
+		p.errorAt(l.Pos, "empty call, use (quote ()) for the empty list")
+	}
+
+	// Parse some call-like structures that are treated in a
+	// different way by the lang
+	if head, ok := l.Nodes[0].(*VarNode); ok {
+		if m, ok := p.macros[head.Name]; ok {
+			return p.parseMacro(m, l)
+		}
+
+		switch head.Name {
+		case "define":
+			return p.parseDefine(l)
+
+		case "set":
+			return p.parseSet(l)
+
+		case "if":
+			return p.parseIf(l)
+
+		case "begin":
+			return p.parseBegin(l)
+
+		case "lambda":
+			return p.parseLambda(l)
+
+		case "quote":
+			return p.parseQuote(l)
+
+		case "let":
+			return p.parseLet(l)
+
+		case "let*":
+			return p.parseLetStar(l)
+
+		case "letrec":
+			return p.parseLetrec(l)
+
+		case "cond":
+			return p.parseCond(l)
+
+		case "case":
+			return p.parseCase(l)
+
+		case "when", "unless":
+			return p.parseWhen(l, head.Name)
+
+		case "and":
+			return &AndNode{Pos: l.Pos, Nodes: p.parseExpressions(l.Nodes[1:])}
+
+		case "or":
+			return &OrNode{Pos: l.Pos, Nodes: p.parseExpressions(l.Nodes[1:])}
+
+		case "do":
+			return p.parseDo(l)
+
+		case "while":
+			return p.parseWhile(l)
+
+		case "dotimes":
+			return p.parseDotimes(l)
+
+		case "break":
+			return p.parseBreak(l)
+
+		case "define-syntax":
+			p.errorAt(l.Pos, "define-syntax is only allowed at the top level")
+		}
+	}
+
+	c := &CallNode{
+		Pos:    l.Pos,
+		Callee: p.parseExpression(l.Nodes[0]),
+		Args:   make([]Node, 0),
+	}
+	for _, arg := range l.Nodes[1:] {
+		c.Args = append(c.Args, p.parseExpression(arg))
+	}
+
+	return c
+}
+
+// Parse the name of the variable assigned by a define or a set.
+func (p *parser) parseAssign(l *ListNode, form string) (*VarNode, Node) {
+	if len(l.Nodes) != 3 {
+		p.errorAt(l.Pos, "bad %s syntax, expected (%s name value)", form, form)
+	}
+
+	name, ok := l.Nodes[1].(*VarNode)
+	if !ok {
+		p.errorAt(l.Nodes[1].Position(), "expected a variable name in %s", form)
+	}
+
+	return p.parseVar(name).(*VarNode), p.parseExpression(l.Nodes[2])
+}
+
+func (p *parser) parseDefine(l *ListNode) Node {
+	name, init := p.parseAssign(l, "define")
 
 	return &DefineNode{
-		Variable: name.(*VarNode),
+		Pos:      l.Pos,
+		Variable: name,
 		Value:    init,
 	}
 }
 
-func (p *parser) parseSet() Node {
-	p.expect(itemCall, "set")
-	name := p.parseVar(false)
-	init := p.parseExpression()
-	p.expect(itemRightParen, "set")
+func (p *parser) parseSet(l *ListNode) Node {
+	name, init := p.parseAssign(l, "set")
 
 	return &SetNode{
-		Variable: name.(*VarNode),
+		Pos:      l.Pos,
+		Variable: name,
 		Value:    init,
 	}
 }
 
-func (p *parser) parseVar(acceptCall bool) Node {
-	var name string
-	if acceptCall && p.peek().t == itemCall {
-		item := p.expect(itemCall, "var")
-		name = item.value
-	} else {
-		item := p.expect(itemVar, "var")
-		name = item.value
+// Return the node of a variable, with the name that it has in the
+// scope where it's used.
+func (p *parser) parseVar(d *VarNode) Node {
+	if mark, ok := p.marks[d]; ok {
+		return &VarNode{Pos: d.Pos, Name: p.resolve(d.Name, mark)}
 	}
-
-	return &VarNode{Name: name}
+	return d
 }
 
-func (p *parser) parseIf() Node {
-	p.expect(itemCall, "if")
+func (p *parser) parseIf(l *ListNode) Node {
+	if len(l.Nodes) != 3 && len(l.Nodes) != 4 {
+		p.errorAt(l.Pos, "bad if syntax, expected (if test conseq [alt])")
+	}
+
 	n := &IfNode{
-		Test:   p.parseExpression(),
-		Conseq: p.parseExpression(),
-		Alt:    p.parseExpression(),
+		Pos:    l.Pos,
+		Test:   p.parseExpression(l.Nodes[1]),
+		Conseq: p.parseExpression(l.Nodes[2]),
+	}
+
+	// Without alternative the if doesn't have any value when the
+	// test is false
+	if len(l.Nodes) == 4 {
+		n.Alt = p.parseExpression(l.Nodes[3])
 	}
-	p.expect(itemRightParen, "if")
 
 	return n
 }
 
-func (p *parser) parseBool() Node {
-	it := p.expect(itemBool, "bool")
+func (p *parser) parseBegin(l *ListNode) Node {
+	if len(l.Nodes) == 1 {
+		p.errorAt(l.Pos, "begin sentence without expressions")
+	}
 
-	if it.value == "#t" || it.value == "#f" {
-		return &BoolNode{Value: it.value == "#t"}
+	nodes := make([]Node, 0)
+	for _, d := range l.Nodes[1:] {
+		nodes = append(nodes, p.parseExpression(d))
 	}
 
-	p.errorf("incorrect boolean value, should be #t or #f: ", it)
-	panic("not reached")
+	return &BeginNode{Pos: l.Pos, Nodes: nodes}
 }
 
-func (p *parser) parseExpression() Node {
-	switch item := p.peek(); item.t {
-	case itemNumber:
-		return p.parseNumber()
+func (p *parser) parseLambda(l *ListNode) Node {
+	if len(l.Nodes) < 2 {
+		p.errorAt(l.Pos, "lambda without arguments list")
+	}
 
-	case itemString:
-		return p.parseString()
+	// Read the arguments list. A single name receives all the arguments
+	// and the name after a dot receives the ones that remain, like
+	// (lambda args ...) and (lambda (a b . rest) ...). Arguments after
+	// #!optional can be omitted, taking their default value or #f.
+	var list *ListNode
+	switch d := l.Nodes[1].(type) {
+	case *VarNode:
+		list = &ListNode{Pos: d.Pos, Nodes: []Node{}, Tail: d}
+	case *ListNode:
+		list = d
+	default:
+		p.errorAt(l.Nodes[1].Position(), "expected a list of arguments in lambda")
+	}
 
-	case itemLeftParen:
-		return p.parseCall()
+	names := make([]*VarNode, 0)
+	defaults := make([]Node, 0)
+	optional := false
+	for _, d := range list.Nodes {
+		if isKeyword(d, "#!optional") {
+			if optional {
+				p.errorAt(d.Position(), "duplicated #!optional in the lambda arguments")
+			}
+			optional = true
+			continue
+		}
 
-	case itemBool:
-		return p.parseBool()
+		if def, ok := d.(*ListNode); ok && optional {
+			if len(def.Nodes) != 2 || def.Tail != nil {
+				p.errorAt(def.Pos, "expected (name default) for the optional argument")
+			}
+			d = def.Nodes[0]
+			defaults = append(defaults, def.Nodes[1])
+		} else if optional {
+			defaults = append(defaults, nil)
+		}
 
-	case itemVar:
-		return p.parseVar(false)
+		name, ok := d.(*VarNode)
+		if !ok {
+			p.errorAt(d.Position(), "expected a variable name in the lambda arguments")
+		}
+		names = append(names, name)
+	}
+	if list.Tail != nil {
+		name, ok := list.Tail.(*VarNode)
+		if !ok {
+			p.errorAt(list.Tail.Position(), "expected a variable name for the rest of the arguments")
+		}
+		names = append(names, name)
+	}
 
-	default:
-		p.errorf("cannot use this kind of value as a expression: %s", item)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name.Name] {
+			p.errorAt(name.Pos, "duplicated argument in lambda: %s", name.Name)
+		}
+		seen[name.Name] = true
 	}
 
-	panic("not reached")
+	// Read the body of the function in the scope of the arguments
+	if len(l.Nodes) == 2 {
+		p.errorAt(l.Pos, "lambda without body")
+	}
+
+	args := p.bind(names)
+	defer p.unbind()
+
+	// Breaks cannot exit the loops that enclose the function
+	loops := p.loops
+	p.loops = 0
+	defer func() { p.loops = loops }()
+
+	n := &LambdaNode{Pos: l.Pos, Optional: len(defaults)}
+	if list.Tail != nil {
+		n.Rest = args[len(args)-1].(*VarNode)
+		args = args[:len(args)-1]
+	}
+	n.Args = args
+
+	// Defaults are evaluated when calling the function, after
+	// assigning the arguments that come before them
+	if len(defaults) > 0 {
+		n.Defaults = make([]Node, len(defaults))
+		for i, d := range defaults {
+			if d != nil {
+				n.Defaults[i] = p.parseExpression(d)
+			}
+		}
+	}
+
+	n.Body = p.parseBody(l.Nodes[2:])
+	return n
 }
 
-func (p *parser) parseBegin() Node {
-	p.expect(itemCall, "begin")
+func (p *parser) parseExpressions(ds []Node) []Node {
+	nodes := make([]Node, len(ds))
+	for i, d := range ds {
+		nodes[i] = p.parseExpression(d)
+	}
+	return nodes
+}
 
-	nodes := make([]Node, 0)
-	for {
-		if item := p.peek(); item.t == itemRightParen {
-			break
+// Parse the body of a lambda or a let; multiple expressions are
+// executed in order like inside a begin.
+func (p *parser) parseBody(ds []Node) Node {
+	nodes := p.parseExpressions(ds)
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return &BeginNode{Pos: nodes[0].Position(), Nodes: nodes}
+}
+
+func (p *parser) parseQuote(l *ListNode) Node {
+	if len(l.Nodes) != 2 {
+		p.errorAt(l.Pos, "bad quote syntax, expected (quote datum)")
+	}
+
+	return &QuoteNode{Pos: l.Pos, Datum: l.Nodes[1]}
+}
+
+// Check the syntax of a let form, returning the names of the variables
+// and the data of their values.
+func (p *parser) parseBindings(l *ListNode, form string) ([]*VarNode, []Node) {
+	if len(l.Nodes) < 3 {
+		p.errorAt(l.Pos, "bad %s syntax, expected (%s ((name value) ...) body ...)", form, form)
+	}
+
+	list, ok := l.Nodes[1].(*ListNode)
+	if !ok {
+		p.errorAt(l.Nodes[1].Position(), "expected a list of bindings in %s", form)
+	}
+
+	names := make([]*VarNode, 0)
+	values := make([]Node, 0)
+	for _, d := range list.Nodes {
+		binding, ok := d.(*ListNode)
+		if !ok || len(binding.Nodes) != 2 {
+			p.errorAt(d.Position(), "bad binding in %s, expected (name value)", form)
+		}
+
+		name, ok := binding.Nodes[0].(*VarNode)
+		if !ok {
+			p.errorAt(binding.Nodes[0].Position(), "expected a variable name in the %s binding", form)
 		}
 
-		nodes = append(nodes, p.parseExpression())
+		// The bindings of let* are nested, so they can repeat names
+		if form != "let*" {
+			for _, other := range names {
+				if other.Name == name.Name {
+					p.errorAt(name.Pos, "duplicated variable in %s: %s", form, name.Name)
+				}
+			}
+		}
+
+		names = append(names, name)
+		values = append(values, binding.Nodes[1])
 	}
 
-	p.expect(itemRightParen, "begin")
+	return names, values
+}
 
-	if len(nodes) == 0 {
-		p.errorf("begin sentence without expressions")
+func (p *parser) parseLet(l *ListNode) Node {
+	if len(l.Nodes) > 1 {
+		if name, ok := l.Nodes[1].(*VarNode); ok {
+			return p.parseNamedLet(l, name)
+		}
 	}
 
-	return &BeginNode{Nodes: nodes}
+	names, ds := p.parseBindings(l, "let")
+
+	// The values are evaluated outside the scope of the variables
+	values := make([]Node, len(ds))
+	for i, d := range ds {
+		values[i] = p.parseExpression(d)
+	}
+
+	vars := p.bind(names)
+	defer p.unbind()
+
+	return &LetNode{
+		Pos:    l.Pos,
+		Vars:   vars,
+		Values: values,
+		Body:   p.parseBody(l.Nodes[2:]),
+	}
 }
 
-func (p *parser) parseLambda() Node {
-	p.expect(itemCall, "lambda")
+// Parse a let* as nested lets, each of them with one of the variables.
+func (p *parser) parseLetStar(l *ListNode) Node {
+	names, ds := p.parseBindings(l, "let*")
+	if len(names) == 0 {
+		return &LetNode{Pos: l.Pos, Body: p.parseBody(l.Nodes[2:])}
+	}
 
-	// Read the arguments list
-	p.expect(itemLeftParen, "lambda")
+	lets := make([]*LetNode, len(names))
+	for i, name := range names {
+		value := p.parseExpression(ds[i])
+		lets[i] = &LetNode{
+			Pos:    l.Pos,
+			Vars:   p.bind([]*VarNode{name}),
+			Values: []Node{value},
+		}
+		defer p.unbind()
+	}
 
-	args := make([]Node, 0)
-	for {
-		item := p.peek()
-		if item.t == itemEOF {
-			p.errorf("unexpected EOF while reading the lambda arguments")
+	for i := 0; i < len(lets)-1; i++ {
+		lets[i].Body = lets[i+1]
+	}
+	lets[len(lets)-1].Body = p.parseBody(l.Nodes[2:])
+
+	return lets[0]
+}
+
+func (p *parser) parseLetrec(l *ListNode) Node {
+	names, ds := p.parseBindings(l, "letrec")
+
+	// The values can reference the variables, to define
+	// recursive functions
+	vars := p.bind(names)
+	defer p.unbind()
+
+	values := make([]Node, len(ds))
+	for i, d := range ds {
+		values[i] = p.parseExpression(d)
+	}
+
+	return &LetNode{
+		Pos:    l.Pos,
+		Rec:    true,
+		Vars:   vars,
+		Values: values,
+		Body:   p.parseBody(l.Nodes[2:]),
+	}
+}
+
+// Parse a named let, a loop written as a recursive function that's
+// called with the initial values of the variables:
+//
+//     ((letrec ((name (lambda (var ...) body ...))) name) value ...)
+func (p *parser) parseNamedLet(l *ListNode, name *VarNode) Node {
+	rest := &ListNode{Pos: l.Pos, Nodes: append([]Node{l.Nodes[0]}, l.Nodes[2:]...)}
+	names, ds := p.parseBindings(rest, "let")
+
+	values := make([]Node, len(ds))
+	for i, d := range ds {
+		values[i] = p.parseExpression(d)
+	}
+
+	loop := p.bind([]*VarNode{name})
+	defer p.unbind()
+
+	args := p.bind(names)
+	defer p.unbind()
+
+	// Breaks cannot exit the loops that enclose the function
+	loops := p.loops
+	p.loops = 0
+	defer func() { p.loops = loops }()
+
+	lambda := &LambdaNode{
+		Pos:  l.Pos,
+		Args: args,
+		Body: p.parseBody(l.Nodes[3:]),
+	}
+
+	return &CallNode{
+		Pos: l.Pos,
+		Callee: &LetNode{
+			Pos:    l.Pos,
+			Rec:    true,
+			Vars:   loop,
+			Values: []Node{lambda},
+			Body:   loop[0],
+		},
+		Args: values,
+	}
+}
+
+// Name of the temporary variable used by the => clauses of cond. It
+// contains a space, so it cannot clash with the names of the code.
+const condValue = "cond value"
+
+// Parse a cond as nested ifs, one for each clause.
+func (p *parser) parseCond(l *ListNode) Node {
+	if len(l.Nodes) == 1 {
+		p.errorAt(l.Pos, "cond without clauses")
+	}
+	return p.parseCondClauses(l.Nodes[1:])
+}
+
+func (p *parser) parseCondClauses(clauses []Node) Node {
+	if len(clauses) == 0 {
+		return nil
+	}
+
+	clause, ok := clauses[0].(*ListNode)
+	if !ok || len(clause.Nodes) == 0 {
+		p.errorAt(clauses[0].Position(), "bad cond clause, expected (test body ...)")
+	}
+
+	if isKeyword(clause.Nodes[0], "else") {
+		if len(clauses) > 1 {
+			p.errorAt(clause.Pos, "else should be the last clause of cond")
+		}
+		if len(clause.Nodes) == 1 {
+			p.errorAt(clause.Pos, "else clause without body")
+		}
+		return p.parseBody(clause.Nodes[1:])
+	}
+
+	test := p.parseExpression(clause.Nodes[0])
+
+	switch {
+	case len(clause.Nodes) == 1:
+		// Clauses without body return the value of the test
+		alt := p.parseCondClauses(clauses[1:])
+		if alt == nil {
+			return test
+		}
+		return &OrNode{Pos: clause.Pos, Nodes: []Node{test, alt}}
+
+	case isKeyword(clause.Nodes[1], "=>"):
+		// Call the function with the value of the test
+		if len(clause.Nodes) != 3 {
+			p.errorAt(clause.Pos, "bad cond clause, expected (test => function)")
 		}
-		if item.t == itemRightParen {
+		f := p.parseExpression(clause.Nodes[2])
+
+		value := &VarNode{Pos: clause.Pos, Name: condValue}
+		return &LetNode{
+			Pos:    clause.Pos,
+			Vars:   []Node{value},
+			Values: []Node{test},
+			Body: &IfNode{
+				Pos:    clause.Pos,
+				Test:   value,
+				Conseq: &CallNode{Pos: clause.Pos, Callee: f, Args: []Node{value}},
+				Alt:    p.parseCondClauses(clauses[1:]),
+			},
+		}
+	}
+
+	return &IfNode{
+		Pos:    clause.Pos,
+		Test:   test,
+		Conseq: p.parseBody(clause.Nodes[1:]),
+		Alt:    p.parseCondClauses(clauses[1:]),
+	}
+}
+
+// Report if the datum is the symbol used as a keyword by some forms.
+func isKeyword(d Node, name string) bool {
+	v, ok := d.(*VarNode)
+	return ok && v.Name == name
+}
+
+func (p *parser) parseCase(l *ListNode) Node {
+	if len(l.Nodes) < 2 {
+		p.errorAt(l.Pos, "bad case syntax, expected (case key clause ...)")
+	}
+
+	n := &CaseNode{Pos: l.Pos, Key: p.parseExpression(l.Nodes[1])}
+	for i, d := range l.Nodes[2:] {
+		clause, ok := d.(*ListNode)
+		if !ok || len(clause.Nodes) < 2 {
+			p.errorAt(d.Position(), "bad case clause, expected ((datum ...) body ...)")
+		}
+
+		if isKeyword(clause.Nodes[0], "else") {
+			if i != len(l.Nodes)-3 {
+				p.errorAt(clause.Pos, "else should be the last clause of case")
+			}
+			n.Else = p.parseBody(clause.Nodes[1:])
 			break
 		}
 
-		args = append(args, p.parseVar(true))
+		datums, ok := clause.Nodes[0].(*ListNode)
+		if !ok {
+			p.errorAt(clause.Nodes[0].Position(), "expected a list of data in the case clause")
+		}
+
+		n.Clauses = append(n.Clauses, &CaseClause{
+			Datums: datums.Nodes,
+			Body:   p.parseBody(clause.Nodes[1:]),
+		})
 	}
-	p.expect(itemRightParen, "lambda")
 
-	// Read the body of the function
-	body := p.parseCall()
+	return n
+}
 
-	p.expect(itemRightParen, "lambda")
+// Parse a when or an unless as an if with only one branch.
+func (p *parser) parseWhen(l *ListNode, form string) Node {
+	if len(l.Nodes) < 3 {
+		p.errorAt(l.Pos, "bad %s syntax, expected (%s test body ...)", form, form)
+	}
 
-	return &LambdaNode{
-		Args: args,
-		Body: body,
+	n := &IfNode{Pos: l.Pos, Test: p.parseExpression(l.Nodes[1])}
+	if form == "when" {
+		n.Conseq = p.parseBody(l.Nodes[2:])
+	} else {
+		n.Alt = p.parseBody(l.Nodes[2:])
 	}
+	return n
+}
+
+func (p *parser) parseDo(l *ListNode) Node {
+	if len(l.Nodes) < 3 {
+		p.errorAt(l.Pos, "bad do syntax, expected (do ((name init step) ...) (test result ...) body ...)")
+	}
+
+	list, ok := l.Nodes[1].(*ListNode)
+	if !ok {
+		p.errorAt(l.Nodes[1].Position(), "expected a list of variables in do")
+	}
+
+	n := &DoNode{Pos: l.Pos}
+	names := make([]*VarNode, 0)
+	steps := make([]Node, 0)
+	for _, d := range list.Nodes {
+		spec, ok := d.(*ListNode)
+		if !ok || len(spec.Nodes) < 2 || len(spec.Nodes) > 3 {
+			p.errorAt(d.Position(), "bad do variable, expected (name init [step])")
+		}
+
+		name, ok := spec.Nodes[0].(*VarNode)
+		if !ok {
+			p.errorAt(spec.Nodes[0].Position(), "expected a variable name in do")
+		}
+		for _, other := range names {
+			if other.Name == name.Name {
+				p.errorAt(name.Pos, "duplicated variable in do: %s", name.Name)
+			}
+		}
+		names = append(names, name)
+
+		// The initial values are evaluated outside the scope of the variables
+		n.Inits = append(n.Inits, p.parseExpression(spec.Nodes[1]))
+
+		var step Node
+		if len(spec.Nodes) == 3 {
+			step = spec.Nodes[2]
+		}
+		steps = append(steps, step)
+	}
+
+	exit, ok := l.Nodes[2].(*ListNode)
+	if !ok || len(exit.Nodes) == 0 {
+		p.errorAt(l.Nodes[2].Position(), "expected (test result ...) in do")
+	}
+
+	n.Vars = p.bind(names)
+	defer p.unbind()
+
+	for _, step := range steps {
+		if step != nil {
+			step = p.parseExpression(step)
+		}
+		n.Steps = append(n.Steps, step)
+	}
+
+	n.Test = p.parseExpression(exit.Nodes[0])
+	if len(exit.Nodes) > 1 {
+		n.Result = p.parseBody(exit.Nodes[1:])
+	}
+	if len(l.Nodes) > 3 {
+		n.Body = p.parseLoopBody(l.Nodes[3:])
+	}
+
+	return n
+}
+
+func (p *parser) parseWhile(l *ListNode) Node {
+	if len(l.Nodes) < 2 {
+		p.errorAt(l.Pos, "bad while syntax, expected (while test body ...)")
+	}
+
+	n := &WhileNode{Pos: l.Pos, Test: p.parseExpression(l.Nodes[1])}
+	if len(l.Nodes) > 2 {
+		n.Body = p.parseLoopBody(l.Nodes[2:])
+	}
+	return n
+}
+
+func (p *parser) parseDotimes(l *ListNode) Node {
+	if len(l.Nodes) < 2 {
+		p.errorAt(l.Pos, "bad dotimes syntax, expected (dotimes (name count [result]) body ...)")
+	}
+
+	spec, ok := l.Nodes[1].(*ListNode)
+	if !ok || len(spec.Nodes) < 2 || len(spec.Nodes) > 3 {
+		p.errorAt(l.Nodes[1].Position(), "expected (name count [result]) in dotimes")
+	}
+
+	name, ok := spec.Nodes[0].(*VarNode)
+	if !ok {
+		p.errorAt(spec.Nodes[0].Position(), "expected a variable name in dotimes")
+	}
+
+	n := &DotimesNode{Pos: l.Pos, Count: p.parseExpression(spec.Nodes[1])}
+
+	n.Var = p.bind([]*VarNode{name})[0].(*VarNode)
+	defer p.unbind()
+
+	if len(spec.Nodes) == 3 {
+		n.Result = p.parseExpression(spec.Nodes[2])
+	}
+	if len(l.Nodes) > 2 {
+		n.Body = p.parseLoopBody(l.Nodes[2:])
+	}
+
+	return n
+}
+
+// Parse the body of a loop, the only place where break can be used.
+func (p *parser) parseLoopBody(nodes []Node) Node {
+	p.loops++
+	defer func() { p.loops-- }()
+
+	return p.parseBody(nodes)
+}
+
+func (p *parser) parseBreak(l *ListNode) Node {
+	if len(l.Nodes) > 2 {
+		p.errorAt(l.Pos, "bad break syntax, expected (break [value])")
+	}
+	if p.loops == 0 {
+		p.errorAt(l.Pos, "break outside of a loop")
+	}
+
+	n := &BreakNode{Pos: l.Pos}
+	if len(l.Nodes) == 2 {
+		n.Value = p.parseExpression(l.Nodes[1])
+	}
+	return n
 }
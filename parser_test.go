@@ -0,0 +1,94 @@
+package water_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ernestokarim/water"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"", false},
+		{"(+ 1 2)", false},
+		{"x", false},
+		{"(+ 1", true},
+		{"(define f (lambda (x)\n  (* x", true},
+		{"(a (b (c)))", false},
+		{"(a))", false},
+		{`"abc`, true},
+		{"\"multi\nline", true},
+		{`"a \" b`, true},
+		{`"a \" b"`, false},
+		{`(print "(")`, false},
+		{"#| comment", true},
+		{"#| outer #| inner |# still", true},
+		{"#| outer #| inner |# done |#", false},
+		{"(a ; )\n", true},
+		{"; (\n", false},
+		{"#;", true},
+		{"#; (a b", true},
+		{"#; a", false},
+		{"'", true},
+		{"'(a", true},
+		{"'a", false},
+		{"(+ 1 #bad)", false},
+	}
+
+	for _, test := range tests {
+		if got := water.Incomplete(test.src); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	src := `; header
+(define x #| inline |# 1)
+#| block
+   #| nested |# |#
+(list x #;(ignored ; inner
+           #;again) 2) ; trailing
+'#;skipped y
+; last`
+
+	want := []string{
+		`test:1:1: "; header"`,
+		`test:2:11: "#| inline |#"`,
+		`test:3:1: "#| block\n   #| nested |# |#"`,
+		`test:5:9: "#;(ignored ; inner\n           #;again)"`,
+		`test:6:24: "; trailing"`,
+		`test:7:2: "#;skipped"`,
+		`test:8:1: "; last"`,
+	}
+
+	root, err := water.Parse("test", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Nodes) != 3 {
+		t.Errorf("got %d nodes, want 3", len(root.Nodes))
+	}
+
+	var got []string
+	for _, c := range root.Comments {
+		got = append(got, fmt.Sprintf("%s: %q", c.Pos, c.Text))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the comments:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNoComments(t *testing.T) {
+	root, err := water.Parse("test", strings.NewReader(`(print "; not a comment #| |#")`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Comments) != 0 {
+		t.Errorf("got %d comments inside a string", len(root.Comments))
+	}
+}
@@ -0,0 +1,130 @@
+package water
+
+import (
+	"sync"
+)
+
+// Variables defined inside the body of a function, a let or an iteration
+// of a loop live in the environment of the body, even if the definition
+// is conditional or appears after their first use. Both backends bind
+// them before executing the body, so a name means the same variable in
+// the whole body.
+type bodyDefines struct {
+	once  sync.Once
+	names []string
+}
+
+// Return the names defined by the nodes, computing them only the
+// first time.
+func (d *bodyDefines) get(nodes ...Node) []string {
+	d.once.Do(func() {
+		for _, n := range nodes {
+			d.names = collectDefines(n, d.names)
+		}
+	})
+	return d.names
+}
+
+func (n *LambdaNode) bodyDefines() []string {
+	nodes := append([]Node{}, n.Defaults...)
+	return n.defines.get(append(nodes, n.Body)...)
+}
+
+func (n *LetNode) bodyDefines() []string {
+	if n.Rec {
+		return n.defines.get(append(append([]Node{}, n.Values...), n.Body)...)
+	}
+	return n.defines.get(n.Body)
+}
+
+func (n *DoNode) bodyDefines() []string {
+	nodes := []Node{n.Test, n.Result, n.Body}
+	return n.defines.get(append(nodes, n.Steps...)...)
+}
+
+func (n *WhileNode) bodyDefines() []string {
+	return n.defines.get(n.Body)
+}
+
+func (n *DotimesNode) bodyDefines() []string {
+	return n.defines.get(n.Body, n.Result)
+}
+
+// Add the variables defined by a node to the names. The functions and
+// the environments nested inside it are not inspected, as they have
+// their own variables.
+func collectDefines(n Node, names []string) []string {
+	switch n := n.(type) {
+	case *DefineNode:
+		found := false
+		for _, name := range names {
+			if name == n.Variable.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, n.Variable.Name)
+		}
+		return collectDefines(n.Value, names)
+
+	case *SetNode:
+		return collectDefines(n.Value, names)
+
+	case *IfNode:
+		names = collectDefines(n.Test, names)
+		names = collectDefines(n.Conseq, names)
+		return collectDefines(n.Alt, names)
+
+	case *AndNode:
+		for _, node := range n.Nodes {
+			names = collectDefines(node, names)
+		}
+
+	case *OrNode:
+		for _, node := range n.Nodes {
+			names = collectDefines(node, names)
+		}
+
+	case *DoNode:
+		for _, init := range n.Inits {
+			names = collectDefines(init, names)
+		}
+
+	case *WhileNode:
+		return collectDefines(n.Test, names)
+
+	case *DotimesNode:
+		return collectDefines(n.Count, names)
+
+	case *BreakNode:
+		return collectDefines(n.Value, names)
+
+	case *CaseNode:
+		names = collectDefines(n.Key, names)
+		for _, clause := range n.Clauses {
+			names = collectDefines(clause.Body, names)
+		}
+		return collectDefines(n.Else, names)
+
+	case *BeginNode:
+		for _, node := range n.Nodes {
+			names = collectDefines(node, names)
+		}
+
+	case *CallNode:
+		names = collectDefines(n.Callee, names)
+		for _, arg := range n.Args {
+			names = collectDefines(arg, names)
+		}
+
+	case *LetNode:
+		if !n.Rec {
+			for _, value := range n.Values {
+				names = collectDefines(value, names)
+			}
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,78 @@
+package water
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Build a string replacing the directives of the format with the
+// arguments: ~a displays the value like print does, ~s writes it like
+// it's read, quoting the strings, ~% is a newline and ~~ a tilde.
+func format(args ...Value) (Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected a format string")
+	}
+	f, ok := args[0].(String)
+	if !ok {
+		return nil, fmt.Errorf("expected a format string, got %s", typeName(args[0]))
+	}
+	args = args[1:]
+
+	var buf bytes.Buffer
+	runes := []rune(string(f))
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '~' {
+			buf.WriteRune(runes[i])
+			continue
+		}
+
+		i++
+		if i == len(runes) {
+			return nil, fmt.Errorf("incomplete directive at the end of the format")
+		}
+
+		switch d := runes[i]; d {
+		case '~':
+			buf.WriteByte('~')
+
+		case '%':
+			buf.WriteByte('\n')
+
+		case 'a', 's':
+			if len(args) == 0 {
+				return nil, fmt.Errorf("not enough arguments for the format")
+			}
+			if d == 'a' {
+				buf.WriteString(display(args[0]))
+			} else {
+				buf.WriteString(formatDatum(args[0]))
+			}
+			args = args[1:]
+
+		default:
+			return nil, fmt.Errorf("unknown format directive: ~%c", d)
+		}
+	}
+
+	if len(args) > 0 {
+		return nil, fmt.Errorf("too many arguments for the format")
+	}
+
+	return String(buf.String()), nil
+}
+
+// Text of a value when it's printed: the strings without quotes.
+func display(v Value) string {
+	if s, ok := v.(String); ok {
+		return string(s)
+	}
+	return v.String()
+}
+
+func numberToString(v Value) (Value, error) {
+	switch v.(type) {
+	case Int, *BigInt, Float:
+		return String(v.String()), nil
+	}
+	return nil, fmt.Errorf("expected a number, got %s", typeName(v))
+}
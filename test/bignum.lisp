@@ -0,0 +1,32 @@
+
+30414093201713378043612608166064768844377641568960512000000000000
+-123456789012345678901234567890
+(+ 9223372036854775807 1)
+-9223372036854775808
+(- -9223372036854775808 1)
+(* 4294967296 4294967296 10)
+(- (+ 9223372036854775807 1) 1)
+(/ 30414093201713378043612608166064768844377641568960512000000000000 1000000000000)
+(/ 100000000000000000000 3)
+(% 100000000000000000001 10)
+(+ 100000000000000000000 0.5)
+(> 100000000000000000000 99999999999999999999)
+(< 5 100000000000000000000)
+'(100000000000000000000)
+
+###########################################################
+
+30414093201713378043612608166064768844377641568960512000000000000
+-123456789012345678901234567890
+9223372036854775808
+-9223372036854775808
+-9223372036854775809
+184467440737095516160
+9223372036854775807
+30414093201713378043612608166064768844377641568960512
+3.333333333333333e+19
+1
+1e+20
+true
+true
+(100000000000000000000)
@@ -0,0 +1,12 @@
+(define z 1)
+(define f (lambda () (define g z) (define z 4) g))
+(f)
+
+###########################################################
+
+1
+<lambda value with arity 0>
+ERROR: <stdin>:2:32: variable not defined: z
+	(define f (lambda () (define g z) (define z 4) g))
+	                               ^
+	in f called at <stdin>:3:1
@@ -0,0 +1,13 @@
+(define y 1)
+(define f (lambda () (when #f (define y 2)) (set y 5)))
+(f)
+y
+
+###########################################################
+
+1
+<lambda value with arity 0>
+ERROR: <stdin>:2:45: variable not defined: y
+	(define f (lambda () (when #f (define y 2)) (set y 5)))
+	                                            ^
+	in f called at <stdin>:3:1
@@ -0,0 +1,22 @@
+(define f (lambda () (define a 1) (define h (lambda () b)) (define b 2) (h)))
+(f)
+(define g (lambda (n) (if (> n 0) (define r (quote positive)) (define r (quote other))) r))
+(list (g 1) (g 0))
+(let ((q 1)) (define w (+ q 1)) w)
+(define x 1)
+(define k (lambda () (if #f (define x 2)) x))
+(k)
+
+###########################################################
+
+<lambda value with arity 0>
+2
+<lambda value with arity 1>
+(positive other)
+2
+1
+<lambda value with arity 0>
+ERROR: <stdin>:7:43: variable not defined: x
+	(define k (lambda () (if #f (define x 2)) x))
+	                                          ^
+	in k called at <stdin>:8:1
@@ -0,0 +1,7 @@
+(do ((i (break 1) (+ i 1))) ((= i 3) i))
+
+###########################################################
+
+ERROR: <stdin>:1:9: break outside of a loop
+	(do ((i (break 1) (+ i 1))) ((= i 3) i))
+	        ^
@@ -0,0 +1,40 @@
+
+((lambda (r) (* r r)) 5)
+((if (> 3 0) + -) 0 3)
+((if (< 3 0) + -) 0 3)
+
+(define abs (lambda (n) ((if (> n 0) + -) 0 n)))
+(list (abs -3) (abs 0) (abs 3))
+
+(define twice (lambda (x) (* 2 x)))
+(define compose (lambda (f g) (lambda (x) (f (g x)))))
+((compose list twice) 5)
+
+(define plus +)
+(plus 1 2 3)
+car
+
+(define combine (lambda (f)
+  (lambda (x y)
+    (if (null? x) (quote ())
+        (f (list (car x) (car y))
+           ((combine f) (cdr x) (cdr y)))))))
+(define zip (combine cons))
+(zip (list 1 2 3 4) (list 5 6 7 8))
+
+###########################################################
+
+25
+3
+-3
+<lambda value with arity 1>
+(3 0 3)
+<lambda value with arity 1>
+<lambda value with arity 2>
+(10)
+<builtin function +>
+6
+<builtin function car>
+<lambda value with arity 1>
+<lambda value with arity 2>
+((1 5) (2 6) (3 7) (4 8))
@@ -0,0 +1,43 @@
+
+(define twice (lambda (x) (* 2 x)))
+(define compose (lambda (f g) (lambda (x) (f (g x)))))
+(define repeat (lambda (f) (compose f f)))
+(define quad (repeat twice))
+(quad 5)
+(define oct (repeat (repeat twice)))
+(oct 5)
+
+(define fact (lambda (n) (if (<= n 1) 1 (* n (fact (- n 1))))))
+(fact 3)
+(fact 50)
+
+(define make-adder (lambda (n) (lambda (x) (+ x n))))
+(define add3 (make-adder 3))
+(define n 100)
+(add3 4)
+
+(define make-counter (lambda (c) (lambda (x) (set c (+ c x)))))
+(define counter (make-counter 10))
+(counter 1)
+(counter 5)
+
+###########################################################
+
+<lambda value with arity 1>
+<lambda value with arity 2>
+<lambda value with arity 1>
+<lambda value with arity 1>
+20
+<lambda value with arity 1>
+80
+<lambda value with arity 1>
+6
+30414093201713378043612608166064768844377641568960512000000000000
+<lambda value with arity 1>
+<lambda value with arity 1>
+100
+7
+<lambda value with arity 1>
+<lambda value with arity 1>
+11
+16
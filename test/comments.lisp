@@ -0,0 +1,31 @@
+; A line comment at the start
+(define x 1) ; a trailing comment
+(+ x 2);no space before it
+#| a block comment
+   spanning lines #| with a nested one |#
+   still commented (+ 1 2) |#
+(+ x #| inline |# 3)
+#;(print "never printed\n")
+(list 1 #;2 3 #; (4 5) 6)
+(list #; #; 1 2 3)
+'(a . #;b c)
+"a ; inside a string"
+(list 'a;comment
+  'b)
+#; 10
+(define-syntax twice ; macros too
+  (syntax-rules ()
+    ((twice e) (begin e e)))) ; end
+(twice (print "hi\n"))
+
+###########################################################
+
+1
+3
+4
+(1 3 6)
+(3)
+(a . c)
+a ; inside a string(a b)
+hi
+hi
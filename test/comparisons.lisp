@@ -0,0 +1,33 @@
+(list (< 1 2 3) (< 1 3 2) (<= 1 1 2) (> 3 2 1) (>= 3 3 3) (= 2 2 2) (= 2 2 3))
+(list (= 1 1.0) (< 1 1.5 2) (= 100000000000000000000 1e20) (= 9007199254740993 9007199254740992.0))
+(list (< 1 100000000000000000000 1e30) (> 2.5 2 -100000000000000000000))
+(define nan (- (* 1e308 10) (* 1e308 10)))
+(list (= nan nan) (< nan 1) (> nan 1) (< 1 2 nan))
+(list (eq? 'a 'a) (eqv? 1 1) (eqv? 1 1.0) (eqv? 100000000000000000000 100000000000000000000))
+(define l (list 1 2))
+(list (eq? l l) (eq? l (list 1 2)) (equal? l (list 1 2)) (eqv? '() '()))
+(list (equal? "abc" "abc") (equal? '(1 (2 "x") . 3) '(1 (2 "x") . 3)) (equal? '(1 2) '(1 2 3)) (equal? 1 1.0))
+(list (eqv? car car) (eqv? (lambda (x) x) (lambda (x) x)))
+(list (min 1 nan) (max nan 1) (min 2 nan 1) (max 1 2.5))
+(list (< 1) (= 2) (>= 1.5))
+(list (= "a" "a") (= (quote x) (quote x)) (= 1 "a") (= (list 1) (list 1)) (= l l))
+(< 1 2 "x")
+
+###########################################################
+
+(true false true true true true false)
+(true true true false)
+(true true)
+NaN
+(false false false false)
+(true true false true)
+(1 2)
+(true false true true)
+(true true false false)
+(true false)
+(NaN NaN NaN 2.5)
+(true true true)
+(true true false false true)
+ERROR: <stdin>:14:1: error calling <: cannot compare non-numeric values
+	(< 1 2 "x")
+	^
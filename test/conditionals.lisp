@@ -0,0 +1,57 @@
+(define sign (lambda (n)
+  (cond ((< n 0) (quote negative))
+        ((= n 0) (quote zero))
+        (else (quote positive)))))
+(list (sign -5) (sign 0) (sign 7))
+(define member? (lambda (x l)
+  (cond ((null? l) #f)
+        ((= (car l) x) #t)
+        (else (member? x (cdr l))))))
+(cond ((member? 2 (quote (1 2))) => (lambda (found) (list found 2)))
+      (else (quote none)))
+(cond ((member? 3 (quote (1 2))) => (lambda (found) (list found 3)))
+      (else (quote none)))
+(cond (#f 1) ((member? 1 (quote (1)))))
+(cond (#f 1))
+(define kind (lambda (x)
+  (case x
+    ((1 2 3) (quote small))
+    ((a b) (quote letter))
+    (("hi") (quote greeting))
+    (else (quote other)))))
+(list (kind 2) (kind (quote b)) (kind "hi") (kind 99) (kind 2.0))
+(case 5 ((1) 1))
+(when (< 1 2) (println "when") 1)
+(when (> 1 2) (println "never"))
+(unless (> 1 2) (println "unless") 2)
+(list (and) (or) (and #t #t) (and #t #f) (or #f #t) (or #f #f))
+(and #f (car 1))
+(or #t (car 1))
+(define loop (lambda (i) (and #t (or #f (if (= i 0) (quote done) (loop (- i 1)))))))
+(loop 100000)
+(and #t 5)
+(or #f 5)
+(or 5 #t)
+
+###########################################################
+
+<lambda value with arity 1>
+(negative zero positive)
+<lambda value with arity 2>
+(true 2)
+none
+true
+<lambda value with arity 1>
+(small letter greeting other other)
+when
+1
+unless
+2
+(true false true false true false)
+false
+true
+<lambda value with arity 1>
+done
+5
+5
+5
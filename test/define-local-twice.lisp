@@ -0,0 +1,10 @@
+(define g (lambda () (define y 1) (define y 2) y))
+(g)
+
+###########################################################
+
+<lambda value with arity 0>
+ERROR: <stdin>:1:35: variable already defined: y
+	(define g (lambda () (define y 1) (define y 2) y))
+	                                  ^
+	in g called at <stdin>:2:1
@@ -1,8 +1,18 @@
 
 (define x (+ 2 1))
 (print "%d\n" x)
+(define x 5)
+x
+(define double (lambda (n) (+ n n n)))
+(define double (lambda (n) (* n 2)))
+(double 4)
 
 ###########################################################
 
 3
 3
+5
+5
+<lambda value with arity 1>
+<lambda value with arity 1>
+8
@@ -3,4 +3,6 @@
 
 ###########################################################
 
-ERROR: error calling /: division by zero
+ERROR: <stdin>:2:1: error calling /: division by zero
+	(/ 3 0)
+	^
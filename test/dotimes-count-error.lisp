@@ -0,0 +1,7 @@
+(dotimes (i 100000000000000000000) (break))
+
+###########################################################
+
+ERROR: <stdin>:1:13: dotimes count is too large
+	(dotimes (i 100000000000000000000) (break))
+	            ^
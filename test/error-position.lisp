@@ -0,0 +1,14 @@
+
+(define first (lambda (x)
+  (+ 1 (car x))))
+(first (list 4))
+(first 5)
+
+###########################################################
+
+<lambda value with arity 1>
+5
+ERROR: <stdin>:3:8: error calling car: expected a non-empty list, got 5
+	  (+ 1 (car x))))
+	       ^
+	in first called at <stdin>:5:1
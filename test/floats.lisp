@@ -0,0 +1,42 @@
+
+2.0
+-3.14e159
+1.5e-3
+(+ 1.5 2)
+(* 2 0.25)
+(- 5.5)
+(/ 10 4)
+(/ 10 5)
+(/ 1.0 4)
+(% 7.5 2)
+(> 2.5 2)
+(< 1 1.5)
+(>= 2.0 2)
+(<= 3 2.5)
+'(1.0 (2.0))
+1e400
+-1e400
+09.5
+010
+
+###########################################################
+
+2.0
+-3.14e+159
+0.0015
+3.5
+0.5
+-5.5
+2.5
+2
+0.25
+1.5
+true
+true
+true
+false
+(1.0 (2.0))
++Inf
+-Inf
+9.5
+8
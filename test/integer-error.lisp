@@ -0,0 +1,7 @@
+(remainder 7.5 2)
+
+###########################################################
+
+ERROR: <stdin>:1:1: error calling remainder: expected an integer, got the float 7.5
+	(remainder 7.5 2)
+	^
@@ -0,0 +1,50 @@
+(define sum (lambda args (if (null? args) 0 (+ (car args) (apply-sum (cdr args))))))
+(define apply-sum (lambda (l) (if (null? l) 0 (+ (car l) (apply-sum (cdr l))))))
+(sum)
+(sum 1 2 3)
+((lambda (a b . rest) (list a b rest)) 1 2)
+((lambda (a b . rest) (list a b rest)) 1 2 3 4)
+(define greet (lambda (name #!optional (greeting "hello") punct) (list greeting name punct)))
+(greet "bob")
+(greet "bob" "hi")
+(greet "bob" "hi" "!")
+(define f (lambda (a #!optional (b (* a 2)) . rest) (list a b rest)))
+(f 1)
+(f 1 5 6 7)
+greet
+f
+sum
+'(1 2 . 3)
+'(1 . (2 3))
+(define-syntax my-list
+  (syntax-rules ()
+    ((my-list first . rest) (list first 'rest))))
+(my-list 1 2 3)
+(my-list 1)
+(greet)
+
+###########################################################
+
+<lambda value with arity at least 0>
+<lambda value with arity 1>
+0
+6
+(1 2 ())
+(1 2 (3 4))
+<lambda value with arity 1 to 3>
+("hello" "bob" false)
+("hi" "bob" false)
+("hi" "bob" "!")
+<lambda value with arity at least 1>
+(1 2 ())
+(1 5 (6 7))
+<lambda value with arity 1 to 3>
+<lambda value with arity at least 1>
+<lambda value with arity at least 0>
+(1 2 . 3)
+(1 2 3)
+(1 (2 3))
+(1 ())
+ERROR: <stdin>:24:1: wrong number of args for greet: want 1 to 3, got 0
+	(greet)
+	^
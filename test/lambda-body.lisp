@@ -0,0 +1,38 @@
+
+(define id (lambda (x) x))
+(id 5)
+
+(define sign (lambda (n) (if (< n 0) "negative\n" "positive\n")))
+(sign -3)
+(sign 3)
+
+(define const (lambda () 42))
+(const)
+
+(define hypot2 (lambda (a b)
+  (define a2 (* a a))
+  (define b2 (* b b))
+  (+ a2 b2)))
+(hypot2 3 4)
+(hypot2 5 12)
+
+(define greet (lambda (name)
+  (print "hello, %s\n" name)
+  'done))
+(greet "world")
+
+###########################################################
+
+<lambda value with arity 1>
+5
+<lambda value with arity 1>
+negative
+positive
+<lambda value with arity 0>
+42
+<lambda value with arity 2>
+25
+169
+<lambda value with arity 1>
+hello, world
+done
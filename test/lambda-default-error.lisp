@@ -0,0 +1,12 @@
+(define k (lambda (a #!optional (b (car a))) (list a b)))
+(k (list 1 2))
+(k 1)
+
+###########################################################
+
+<lambda value with arity 1 to 2>
+((1 2) 1)
+ERROR: <stdin>:1:36: error calling car: expected a non-empty list, got 1
+	(define k (lambda (a #!optional (b (car a))) (list a b)))
+	                                   ^
+	in k called at <stdin>:3:1
@@ -0,0 +1,53 @@
+(define x 10)
+(let ((x 1) (y x)) (+ x y))
+(let* ((a 1) (b (+ a 1)) (c (* b 3))) (list a b c))
+(let* () 5)
+(let* ((a 1) (a (+ a 1)) (a (* a 10))) a)
+(letrec ((even? (lambda (n) (if (= n 0) #t (odd? (- n 1)))))
+         (odd? (lambda (n) (if (= n 0) #f (even? (- n 1))))))
+  (even? 1001))
+(let loop ((i 0) (acc (quote ())))
+  (if (= i 5)
+    acc
+    (loop (+ i 1) (cons i acc))))
+(let count ((i 0))
+  (if (< i 100000) (count (+ i 1)) i))
+(define make-counter (lambda ()
+  (let ((n 0))
+    (lambda () (set n (+ n 1)) n))))
+(define c1 (make-counter))
+(c1)
+(c1)
+(define repeat (lambda (k)
+  (let ((v (* k 2)))
+    (define w (+ v 1))
+    w)))
+(repeat 3)
+(repeat 4)
+(+ 1 (let ((z 2)) (* z z)))
+x
+(let ((f (lambda () (car 1)))) (f))
+
+###########################################################
+
+10
+11
+(1 2 6)
+5
+20
+false
+(4 3 2 1 0)
+100000
+<lambda value with arity 0>
+<lambda value with arity 0>
+1
+2
+<lambda value with arity 1>
+7
+9
+5
+10
+ERROR: <stdin>:29:21: error calling car: expected a non-empty list, got 1
+	(let ((f (lambda () (car 1)))) (f))
+	                    ^
+	in f called at <stdin>:29:32
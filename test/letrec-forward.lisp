@@ -0,0 +1,11 @@
+(letrec ((even? (lambda (n) (if (= n 0) #t (odd? (- n 1))))) (odd? (lambda (n) (if (= n 0) #f (even? (- n 1)))))) (even? 10))
+(define b 10)
+(letrec ((a b) (b 2)) a)
+
+###########################################################
+
+true
+10
+ERROR: <stdin>:3:13: variable not defined: b
+	(letrec ((a b) (b 2)) a)
+	            ^
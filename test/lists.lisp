@@ -0,0 +1,34 @@
+
+(list 1 2 3)
+(list)
+(cons 1 (list 2 3))
+(cons 1 2)
+(car (list 1 2 3))
+(cdr (list 1 2 3))
+(car (cdr (list 1 2 3)))
+(list "a" (list #t 4))
+
+(null? (list))
+(null? (list 1))
+(length (list 1 2 3))
+(append (list 1 2) (list 3) (list) (list 4 5))
+
+(define l (list 4 5 6))
+(+ (car l) (length l))
+
+###########################################################
+
+(1 2 3)
+()
+(1 2 3)
+(1 . 2)
+1
+(2 3)
+2
+("a" (true 4))
+true
+false
+3
+(1 2 3 4 5)
+(4 5 6)
+7
@@ -0,0 +1,68 @@
+(do ((i 0 (+ i 1))
+     (acc (quote ()) (cons i acc)))
+    ((= i 5) acc))
+(do ((i 0 (+ i 1))) ((= i 3)) (print "%d " i))
+(println)
+(define fns (do ((i 0 (+ i 1))
+                 (l (quote ()) (cons (lambda () i) l)))
+                ((= i 3) l)))
+(list ((car fns)) ((car (cdr fns))))
+(define n 0)
+(while (< n 5) (set n (+ n 1)))
+n
+(define total 0)
+(dotimes (i 5) (set total (+ total i)))
+total
+(dotimes (i 3 (* i 10)) (print "%d " i))
+(dotimes (i 0 (quote none)))
+(define first-negative (lambda (l)
+  (do ((rest l (cdr rest)))
+      ((null? rest) #f)
+    (when (< (car rest) 0) (break (car rest))))))
+(first-negative (list 1 2 -3 4))
+(first-negative (list 1 2))
+(define count 0)
+(while #t
+  (set count (+ count 1))
+  (when (= count 10) (break)))
+count
+(dotimes (i 3)
+  (dotimes (j 3)
+    (when (= j 1) (break))
+    (print "%d%d " i j)))
+(println)
+(list 1 (dotimes (i 10) (let ((x (* i i))) (when (> x 10) (break (list x))))))
+(do ((i 0 (+ i 1))) ((= i 100000) i))
+(dotimes (i 2) (define sq (* i i)) (print "%d " sq))
+(println)
+(define k 0)
+(while (< k 3) (define sq (* k k)) (print "%d " sq) (set k (+ k 1)))
+(println)
+(dotimes (i "3"))
+
+###########################################################
+
+(4 3 2 1 0)
+0 1 2 
+(<lambda value with arity 0> <lambda value with arity 0> <lambda value with arity 0>)
+(2 1)
+0
+5
+0
+10
+0 1 2 30
+none
+<lambda value with arity 1>
+-3
+false
+0
+10
+00 10 20 
+(1 (16))
+100000
+0 1 
+0
+0 1 4 
+ERROR: <stdin>:41:13: dotimes count is not an integer
+	(dotimes (i "3"))
+	            ^
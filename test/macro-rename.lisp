@@ -0,0 +1,12 @@
+(define-syntax m (syntax-rules () ((m x) ((lambda (a) (+ a x)) 1))))
+(define a.1 7)
+(define a 1.5)
+(m a.1)
+(m a)
+
+###########################################################
+
+7
+1.5
+8
+2.5
@@ -0,0 +1,54 @@
+(define-syntax my-when
+  (syntax-rules ()
+    ((_ test body ...) (if test (begin body ...) 0))))
+(my-when (< 1 2) (println "one") 2)
+(my-when (> 1 2) (println "two") 3)
+
+(define-syntax swap
+  (syntax-rules ()
+    ((_ a b) ((lambda (tmp) (set a b) (set b tmp)) a))))
+(define tmp 1)
+(define other 2)
+(swap tmp other)
+(list tmp other)
+
+(define-syntax my-or
+  (syntax-rules ()
+    ((_) #f)
+    ((_ e) e)
+    ((_ e r ...) ((lambda (t) (if t t (my-or r ...))) e))))
+(define t 5)
+(my-or #f t)
+
+(define-syntax for
+  (syntax-rules (in)
+    ((_ x in lst body) (map1 (lambda (x) body) lst))))
+(define map1 (lambda (f l)
+  (if (null? l) (quote ()) (cons (f (car l)) (map1 f (cdr l))))))
+(for y in (list 1 2 3) (* y y))
+
+(define-syntax my-let
+  (syntax-rules ()
+    ((_ ((name val) ...) body1 body2 ...) ((lambda (name ...) body1 body2 ...) val ...))))
+(my-let ((a 1) (b 2)) (+ a b))
+
+(define-syntax flatten
+  (syntax-rules ()
+    ((_ (a b ...) ...) (quote (a ... (b ... end) ...)))))
+(flatten (1 2 3) (4) (5 6))
+
+###########################################################
+
+one
+2
+0
+1
+2
+1
+(2 1)
+5
+5
+<lambda value with arity 2>
+(1 4 9)
+3
+(1 4 5 (2 3 end) (end) (6 end))
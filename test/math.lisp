@@ -0,0 +1,39 @@
+(list (sqrt 16) (sqrt 2) (sqrt 2.25) (sqrt (* 12345678901234567890 12345678901234567890)))
+(list (expt 2 10) (expt 2 100) (expt 2 -1) (expt 2.0 3) (expt 4 0.5))
+(list (exp 0) (log 1) (log 100 10) (log (expt 2 1000) 2))
+(list (sin 0) (cos 0) (tan 0) (atan 1 1) (atan 0))
+(list (floor 2.5) (ceiling 2.5) (round 2.5) (round 3.5) (round -2.5) (truncate -2.7) (floor 7))
+(list (abs -5) (abs 5.5) (abs -123456789012345678901234567890))
+(list (min 3 1 2) (max 3 1 2) (max 1 2.0) (min 100000000000000000000 -1))
+(list (gcd 12 18) (gcd -12 18) (gcd) (lcm 4 6) (lcm -3 5) (lcm) (gcd 123456789012345678901234567890 10))
+(list (quotient 17 5) (quotient -17 5) (remainder 17 -5) (remainder -17 5) (modulo 17 -5) (modulo -17 5) (modulo 17 5))
+(quotient 123456789012345678901234567890 10)
+(list (quotient 7.0 2) (remainder 7.0 2) (modulo -7 2.0) (gcd 4.0 6) (lcm 3 4.0))
+(random-seed 42)
+(begin (define a (random 1000)) (< a 1000))
+(random-seed 42)
+(= a (random 1000))
+(< (random 1.0) 1.0)
+(< (random 100000000000000000000) 100000000000000000000)
+(quotient 1 0)
+
+###########################################################
+
+(4 1.4142135623730951 1.5 12345678901234567890)
+(1024 1267650600228229401496703205376 0.5 8.0 2.0)
+(1.0 0.0 2.0 999.9999999999999)
+(0.0 1.0 0.0 0.7853981633974483 0.0)
+(2.0 3.0 2.0 4.0 -2.0 -2.0 7)
+(5 5.5 123456789012345678901234567890)
+(1 3 2.0 -1)
+(6 6 0 12 15 1 10)
+(3 -3 2 -2 -3 3 2)
+12345678901234567890123456789
+(3.0 1.0 1.0 2.0 12.0)
+true
+true
+true
+true
+ERROR: <stdin>:18:1: error calling quotient: division by zero
+	(quotient 1 0)
+	^
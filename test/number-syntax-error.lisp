@@ -0,0 +1,7 @@
+(+ 1 08)
+
+###########################################################
+
+ERROR: <stdin>:1:6: illegal number syntax: 08
+	(+ 1 08)
+	     ^
@@ -1,11 +1,16 @@
-
 (println "Hello world!")
 (println "Adios!" 42)
 
 (print "number: %d$\n" 45)
+(println 2.0 -1.5 (list 1.0 "a"))
+(print "%v %s %.2f\n" 2.0 3.0 2.5)
+(print "%d\n" 100000000000000000000)
 
 ###########################################################
 
 Hello world!
 Adios! 42
 number: 45$
+2.0 -1.5 (1.0 "a")
+2.0 3.0 2.50
+100000000000000000000
@@ -0,0 +1,7 @@
+(list 1 `(2 3))
+
+###########################################################
+
+ERROR: <stdin>:1:9: quasiquote is not supported
+	(list 1 `(2 3))
+	        ^
@@ -0,0 +1,24 @@
+
+(quote x)
+(quote (testing 1 (2 "three") #t))
+(quote ())
+'(a b c)
+'(1 '(2))
+(car '(x y))
+(cdr (quote (x y)))
+(null? '())
+(define f (lambda () '(1 2)))
+(eq? (f) (f))
+
+###########################################################
+
+x
+(testing 1 (2 "three") true)
+()
+(a b c)
+(1 (quote (2)))
+x
+(y)
+true
+<lambda value with arity 0>
+true
@@ -0,0 +1,20 @@
+(define count (lambda (n) (if (= n 0) 0 (+ 1 (count (- n 1))))))
+(count 90000)
+(define loop (lambda (n) (if (= n 0) 'done (loop (- n 1)))))
+(loop 50000)
+(define f (lambda (n) (+ 1 (f n))))
+(f 1)
+
+###########################################################
+
+<lambda value with arity 1>
+90000
+<lambda value with arity 1>
+done
+<lambda value with arity 1>
+ERROR: <stdin>:5:28: stack overflow
+	(define f (lambda (n) (+ 1 (f n))))
+	                           ^
+	in f called at <stdin>:5:28
+	... repeated 99998 more times
+	in f called at <stdin>:6:1
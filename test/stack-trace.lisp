@@ -0,0 +1,18 @@
+
+(define inner (lambda (x) (/ x 0)))
+(define middle (lambda (x) (+ 1 (inner x))))
+(define outer (lambda (x)
+  (* 2 (middle x))))
+(outer (+ 1 2))
+
+###########################################################
+
+<lambda value with arity 1>
+<lambda value with arity 1>
+<lambda value with arity 1>
+ERROR: <stdin>:2:27: error calling /: division by zero
+	(define inner (lambda (x) (/ x 0)))
+	                          ^
+	in inner called at <stdin>:3:33
+	in middle called at <stdin>:5:8
+	in outer called at <stdin>:6:1
@@ -0,0 +1,8 @@
+(print "before")
+"bad \q escape"
+
+###########################################################
+
+ERROR: <stdin>:2:6: unknown escape sequence in the string: \q
+	"bad \q escape"
+	     ^
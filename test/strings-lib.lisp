@@ -0,0 +1,43 @@
+(list (string-append "foo" "bar" "baz") (string-append))
+(string-length "héllo")
+(list (substring "hello world" 6) (substring "héllo" 1 3))
+(string-split "a,b,,c" ",")
+(string-split "  some   words here ")
+(list (string-join '("a" "b" "c") ", ") (string-join (string-split "x y z")))
+(list (string-index "héllo" "llo") (string-index "hello" "z"))
+(list (string-upcase "hello") (string-downcase "HeLLo"))
+(list (string-trim "  padded \n") (string-replace "a-b-c" "-" "+"))
+(list (string->number "42") (string->number "-0x10") (string->number "2.5") (string->number "1e3"))
+(string->number "123456789012345678901234567890")
+(list (string->number "nan") (string->number "abc"))
+(list (string->number "1_000") (string->number "0b101") (string->number "0x1p-2") (string->number "08") (string->number "010") (string->number "0x1F"))
+(list (number->string 42) (number->string 2.0) (number->string (* 99999999999 99999999999)))
+(format "~a + ~a = ~a~%" 1 2 (+ 1 2))
+(list (format "~a and ~s" "text" "text"))
+(format "~s ~a 100~~~%" '(1 "two" three) '(1 "two" three))
+(string-length (format "~a" 1.5))
+(substring "abc" 2 5)
+
+###########################################################
+
+("foobarbaz" "")
+5
+("world" "él")
+("a" "b" "" "c")
+("some" "words" "here")
+("a, b, c" "xyz")
+(2 false)
+("HELLO" "hello")
+("padded" "a+b+c")
+(42 -16 2.5 1000.0)
+123456789012345678901234567890
+(false false)
+(false false false false 8 31)
+("42" "2.0" "9999999999800000000001")
+1 + 2 = 3
+("text and \"text\"")
+(1 "two" three) (1 "two" three) 100~
+3
+ERROR: <stdin>:19:1: error calling substring: range [2, 5) out of bounds for a string of length 3
+	(substring "abc" 2 5)
+	^
@@ -0,0 +1,25 @@
+"say \"hi\"\n"
+"tab:\there\n"
+"unicode: \u{e9} \u{1F600}\n"
+"back\\slash\n"
+"a string
+that spans lines
+"
+#"raw \n string
+with "quotes" \ and backslashes"#
+"\n"
+(list "a\"b" "c\\d" "e\nf" "\u{1}" #"x\y"#)
+'("\t" . "\u{e9}")
+
+###########################################################
+
+say "hi"
+tab:	here
+unicode: é 😀
+back\slash
+a string
+that spans lines
+raw \n string
+with "quotes" \ and backslashes
+("a\"b" "c\\d" "e\nf" "\u{1}" "x\\y")
+("\t" . "é")
@@ -0,0 +1,32 @@
+
+(define loop (lambda (i acc)
+  (if (= i 0)
+      acc
+      (loop (- i 1) (+ acc 1)))))
+(loop 1000000 0)
+
+(define count-down (lambda (n)
+  (begin
+    (define m (- n 1))
+    (if (> m 0) (count-down m) 'done))))
+(count-down 500000)
+
+(define even? (lambda (n) (if (= n 0) #t (odd? (- n 1)))))
+(define odd? (lambda (n) (if (= n 0) #f (even? (- n 1)))))
+(even? 1000001)
+
+(define sum (lambda (l acc)
+  (if (null? l) acc (sum (cdr l) (+ acc (car l))))))
+(sum (list 1 2 3 4 5) 0)
+
+###########################################################
+
+<lambda value with arity 2>
+1000000
+<lambda value with arity 1>
+done
+<lambda value with arity 1>
+<lambda value with arity 1>
+false
+<lambda value with arity 2>
+15
@@ -0,0 +1,32 @@
+(if 0 "zero is true\n" "zero is false\n")
+(if (quote ()) "empty list is true\n" "empty list is false\n")
+(if "" "empty string is true\n" "empty string is false\n")
+(if #f "false is true\n" "false is false\n")
+(if (> 1 2) (println "never"))
+(if (< 1 2) (println "one-armed"))
+(list (not #f) (not #t) (not 0) (not (quote ())) (not "x"))
+(define assoc-like (lambda (x l)
+  (cond ((null? l) #f)
+        ((= (car (car l)) x) (car l))
+        (else (assoc-like x (cdr l))))))
+(cond ((assoc-like 2 (quote ((1 one) (2 two)))) => cdr)
+      (else (quote none)))
+(or (assoc-like 5 (quote ((1 one)))) (quote default))
+(and 1 2 3)
+(and 1 #f 3)
+(when 0 (quote ran))
+
+###########################################################
+
+zero is true
+empty list is true
+empty string is true
+false is false
+one-armed
+(true false false false false)
+<lambda value with arity 2>
+(two)
+default
+3
+false
+ran
@@ -0,0 +1,9 @@
+(print "%d items\n" (length (list 1 2)))
+(print (quote (1 "a")))
+
+###########################################################
+
+2 items
+ERROR: <stdin>:2:1: incorrect argument type, expected string, got list
+	(print (quote (1 "a")))
+	^
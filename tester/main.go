@@ -29,9 +29,13 @@ func testFiles() error {
 			continue
 		}
 
+		// Run the tests with both backends of the interpreter
 		if err := testFile(file.Name()); err != nil {
 			return err
 		}
+		if err := testFile(file.Name(), "-vm"); err != nil {
+			return err
+		}
 	}
 
 	log.Println("All tests passed successfully!")
@@ -39,8 +43,8 @@ func testFiles() error {
 	return nil
 }
 
-func testFile(file string) error {
-	log.Println("Running", file)
+func testFile(file string, args ...string) error {
+	log.Println("Running", file, strings.Join(args, " "))
 
 	f, err := os.Open("test/" + file)
 	if err != nil {
@@ -59,7 +63,7 @@ func testFile(file string) error {
 		return fmt.Errorf("file doesn't have the test section: %s", file)
 	}
 
-	cmd := exec.Command("water")
+	cmd := exec.Command("water", args...)
 
 	in, err := cmd.StdinPipe()
 	if err != nil {
@@ -76,8 +80,8 @@ func testFile(file string) error {
 	}
 
 	if string(output) != parts[1] {
-		return fmt.Errorf("bad output in the %s program.\n\nOUTPUT:\n%s\n\nEXPECTED:\n%s",
-			file, output, parts[1])
+		return fmt.Errorf("bad output in the %s program %s.\n\nOUTPUT:\n%s\n\nEXPECTED:\n%s",
+			file, strings.Join(args, " "), output, parts[1])
 	}
 
 	return nil
@@ -0,0 +1,592 @@
+package water
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Value is a piece of data handled by the interpreter. Go values are
+// converted to and from them when calling the registered functions.
+type Value interface {
+	// Text representation of the value, as printed by the interpreter
+	String() string
+
+	value()
+}
+
+// Functions that can be called from the code: lambdas and builtins.
+type Procedure interface {
+	Value
+	procedure()
+}
+
+type Int int
+
+func (v Int) String() string {
+	return strconv.Itoa(int(v))
+}
+
+func (v Int) value() {}
+
+// Integers too large to fit in an Int.
+type BigInt big.Int
+
+func (v *BigInt) String() string {
+	return (*big.Int)(v).String()
+}
+
+func (v *BigInt) value() {}
+
+type Float float64
+
+// Floats always have a decimal point or an exponent to differentiate
+// them from the integers.
+func (v Float) String() string {
+	str := strconv.FormatFloat(float64(v), 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
+func (v Float) value() {}
+
+type String string
+
+func (v String) String() string {
+	return string(v)
+}
+
+func (v String) value() {}
+
+type Bool bool
+
+func (v Bool) String() string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
+
+func (v Bool) value() {}
+
+// The value of the expressions that don't return anything.
+type Nil struct{}
+
+func (v Nil) String() string {
+	return ""
+}
+
+func (v Nil) value() {}
+
+// Report if a value is true as a condition. Every value except #f is true.
+func isTrue(v Value) bool {
+	b, ok := v.(Bool)
+	return !ok || bool(b)
+}
+
+func isNil(v Value) bool {
+	_, ok := v.(Nil)
+	return ok
+}
+
+// Go values that don't have an equivalent in the interpreter. They can
+// only be passed back to the registered functions.
+type goValue struct {
+	v interface{}
+}
+
+func (v goValue) String() string {
+	return fmt.Sprint(v.v)
+}
+
+func (v goValue) value() {}
+
+// ========================================================
+
+type builtinValue struct {
+	name string
+	call func(args []Value) (Value, error)
+}
+
+func (v *builtinValue) String() string {
+	return fmt.Sprintf("<builtin function %s>", v.name)
+}
+
+func (v *builtinValue) value() {}
+
+func (v *builtinValue) procedure() {}
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	bigType   = reflect.TypeOf((*big.Int)(nil))
+)
+
+// Wrap a Go function as a builtin. The most common signatures are
+// called directly; the rest of them through reflection, converting
+// the arguments to the types of the parameters.
+func newBuiltin(name string, fn interface{}) (*builtinValue, error) {
+	b := &builtinValue{name: name}
+
+	switch fn := fn.(type) {
+	case func(...interface{}) (interface{}, error):
+		b.call = func(args []Value) (Value, error) {
+			in := make([]interface{}, len(args))
+			for i, arg := range args {
+				in[i] = goOf(arg)
+			}
+			res, err := fn(in...)
+			if err != nil {
+				return nil, fmt.Errorf("error calling %s: %s", name, err)
+			}
+			return ValueOf(res), nil
+		}
+
+	case func(a, b interface{}) (bool, error):
+		b.call = func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, arityError(name, arity{2, 2}, len(args))
+			}
+			res, err := fn(goOf(args[0]), goOf(args[1]))
+			if err != nil {
+				return nil, fmt.Errorf("error calling %s: %s", name, err)
+			}
+			return Bool(res), nil
+		}
+
+	case func(Value) (Value, error):
+		b.call = func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, arityError(name, arity{1, 1}, len(args))
+			}
+			res, err := fn(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("error calling %s: %s", name, err)
+			}
+			return res, nil
+		}
+
+	case func(Value, Value) (Value, error):
+		b.call = func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, arityError(name, arity{2, 2}, len(args))
+			}
+			res, err := fn(args[0], args[1])
+			if err != nil {
+				return nil, fmt.Errorf("error calling %s: %s", name, err)
+			}
+			return res, nil
+		}
+
+	case func(...Value) (Value, error):
+		b.call = func(args []Value) (Value, error) {
+			res, err := fn(args...)
+			if err != nil {
+				return nil, fmt.Errorf("error calling %s: %s", name, err)
+			}
+			return res, nil
+		}
+
+	default:
+		f := reflect.ValueOf(fn)
+		if f.Kind() != reflect.Func {
+			return nil, fmt.Errorf("%T is not a function", fn)
+		}
+		if !validReturns(f.Type()) {
+			return nil, fmt.Errorf("can't handle the returns of %s", f.Type())
+		}
+		b.call = func(args []Value) (Value, error) {
+			return callReflect(name, f, args)
+		}
+	}
+
+	return b, nil
+}
+
+// Call a builtin function with the values of the arguments.
+func callBuiltin(b *builtinValue, args []Value) (Value, error) {
+	for _, arg := range args {
+		if isNil(arg) {
+			return nil, fmt.Errorf("argument doesn't return any value")
+		}
+	}
+	return b.call(args)
+}
+
+// Number of arguments accepted by a function. The maximum is negative
+// if it accepts any number of extra arguments.
+type arity struct {
+	min, max int
+}
+
+func (a arity) accepts(n int) bool {
+	return n >= a.min && (a.max < 0 || n <= a.max)
+}
+
+func (a arity) String() string {
+	switch {
+	case a.max < 0:
+		return fmt.Sprintf("at least %d", a.min)
+	case a.min != a.max:
+		return fmt.Sprintf("%d to %d", a.min, a.max)
+	}
+	return fmt.Sprintf("%d", a.min)
+}
+
+func arityError(name string, want arity, got int) error {
+	return fmt.Errorf("wrong number of args for %s: want %s, got %d", name, want, got)
+}
+
+// Call a Go function of any signature, converting the arguments to the
+// types of the parameters and the result back to a value.
+func callReflect(name string, f reflect.Value, args []Value) (Value, error) {
+	// Check if the number of args it's correct
+	t := f.Type()
+	numArgs := t.NumIn()
+	if t.IsVariadic() {
+		numArgs -= 1
+		if len(args) < numArgs {
+			return nil, arityError(name, arity{numArgs, -1}, len(args))
+		}
+	} else if len(args) != numArgs {
+		return nil, arityError(name, arity{numArgs, numArgs}, len(args))
+	}
+
+	// Convert the fixed and the variadic arguments
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if i < numArgs {
+			argType = t.In(i)
+		} else {
+			argType = t.In(numArgs).Elem()
+		}
+
+		var err error
+		if in[i], err = convertArg(argType, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Exec the call
+	res := f.Call(in)
+
+	// Check if the func has and returned an error
+	if len(res) == 2 && !res[1].IsNil() {
+		return nil, fmt.Errorf("error calling %s: %s", name, res[1].Interface().(error))
+	}
+
+	if t.NumOut() == 0 {
+		return Nil{}, nil
+	}
+	return ValueOf(res[0].Interface()), nil
+}
+
+// Check the number of return values of a function: one value, optionally
+// followed by an error.
+func validReturns(t reflect.Type) bool {
+	return t.NumOut() == 0 || t.NumOut() == 1 || (t.NumOut() == 2 && t.Out(1) == errorType)
+}
+
+// Return the correct Go value for an argument based on its needed type.
+// Parameters of type interface{} receive the natural Go value: int,
+// *big.Int, float64, string or bool; the rest of values are passed as
+// they are.
+func convertArg(t reflect.Type, arg Value) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() > 0 && reflect.TypeOf(arg).Implements(t) {
+		return reflect.ValueOf(arg), nil
+	}
+
+	v := reflect.ValueOf(goOf(arg))
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+
+	// Numbers are converted between the different Go types when the
+	// value fits in the parameter
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := arg.(Int); ok {
+			c := reflect.New(t).Elem()
+			if c.OverflowInt(int64(n)) {
+				return reflect.Value{}, fmt.Errorf("integer out of range for %s: %s", t, n)
+			}
+			c.SetInt(int64(n))
+			return c, nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := arg.(Int); ok {
+			c := reflect.New(t).Elem()
+			if n < 0 || c.OverflowUint(uint64(n)) {
+				return reflect.Value{}, fmt.Errorf("integer out of range for %s: %s", t, n)
+			}
+			c.SetUint(uint64(n))
+			return c, nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if n, ok := arg.(Int); ok {
+			return reflect.ValueOf(float64(n)).Convert(t), nil
+		}
+
+	case reflect.Ptr:
+		if n, ok := arg.(Int); ok && t == bigType {
+			return reflect.ValueOf(big.NewInt(int64(n))), nil
+		}
+
+	case reflect.Slice:
+		// Lists are converted item by item
+		if _, ok := arg.(*Pair); ok {
+			items, err := listItems(arg)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+
+			s := reflect.MakeSlice(t, len(items), len(items))
+			for i, item := range items {
+				v, err := convertArg(t.Elem(), item)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				s.Index(i).Set(v)
+			}
+			return s, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("incorrect argument type, expected %s, got %s",
+		goTypeName(t), typeName(arg))
+}
+
+// Convert a value to its natural Go representation.
+func goOf(v Value) interface{} {
+	switch v := v.(type) {
+	case Int:
+		return int(v)
+	case *BigInt:
+		return (*big.Int)(v)
+	case Float:
+		return float64(v)
+	case String:
+		return string(v)
+	case Bool:
+		return bool(v)
+	case goValue:
+		return v.v
+	}
+	return v
+}
+
+// Convert a Go value to a value of the interpreter. Slices are converted
+// to lists, and the values without an equivalent are kept as they are to
+// pass them back to the Go functions.
+func ValueOf(x interface{}) Value {
+	switch x := x.(type) {
+	case nil:
+		return Nil{}
+	case Value:
+		return x
+	case *big.Int:
+		return bigValue(x)
+	case int:
+		return Int(x)
+	case int64:
+		return bigValue(big.NewInt(x))
+	case float64:
+		return Float(x)
+	case string:
+		return String(x)
+	case bool:
+		return Bool(x)
+	case []interface{}:
+		items := make([]Value, len(x))
+		for i, item := range x {
+			items[i] = ValueOf(item)
+		}
+		return list(items...)
+	}
+
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return Int(v.Int())
+	case reflect.Int, reflect.Int64:
+		return bigValue(big.NewInt(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return bigValue(new(big.Int).SetUint64(v.Uint()))
+	case reflect.Float32:
+		return Float(v.Float())
+	case reflect.String:
+		return String(v.String())
+	case reflect.Bool:
+		return Bool(v.Bool())
+	case reflect.Slice:
+		items := make([]Value, v.Len())
+		for i := range items {
+			items[i] = ValueOf(v.Index(i).Interface())
+		}
+		return list(items...)
+	}
+
+	return goValue{x}
+}
+
+// Return an Int if the number fits in one.
+func bigValue(n *big.Int) Value {
+	if n.IsInt64() {
+		if i := Int(n.Int64()); int64(i) == n.Int64() {
+			return i
+		}
+	}
+	return (*BigInt)(n)
+}
+
+// Report if two values are the same: numbers of the same type with the
+// same value, strings with the same text, symbols with the same name and
+// the same list or function.
+func eqv(a, b Value) bool {
+	switch a := a.(type) {
+	case *BigInt:
+		n, ok := b.(*BigInt)
+		return ok && (*big.Int)(a).Cmp((*big.Int)(n)) == 0
+
+	case goValue:
+		v, ok := b.(goValue)
+		return ok && reflect.TypeOf(a.v).Comparable() && a.v == v.v
+	}
+
+	return a == b
+}
+
+// Report if two values have the same structure: lists with equal
+// elements, or any other values that are eqv.
+func equal(a, b Value) bool {
+	for {
+		p, pok := a.(*Pair)
+		q, qok := b.(*Pair)
+		if !pok || !qok || p == nil || q == nil {
+			return eqv(a, b)
+		}
+
+		if !equal(p.Car, q.Car) {
+			return false
+		}
+		a, b = p.Cdr, q.Cdr
+	}
+}
+
+// Values have no identity apart from the lists and the functions,
+// so eq? is the same as eqv?.
+func eqvFunc(a, b Value) (Value, error) {
+	return Bool(eqv(a, b)), nil
+}
+
+func equalFunc(a, b Value) (Value, error) {
+	return Bool(equal(a, b)), nil
+}
+
+// Name of the type of a value, for the error messages.
+func typeName(v Value) string {
+	switch v := v.(type) {
+	case Int, *BigInt:
+		return "int"
+	case Float:
+		return "float"
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Symbol:
+		return "symbol"
+	case *Pair:
+		return "list"
+	case Procedure:
+		return "procedure"
+	case Nil:
+		return "nil"
+	case goValue:
+		return fmt.Sprintf("%T", v.v)
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Name of the type of a Go parameter, using the names of the interpreter
+// for the types that have an equivalent.
+func goTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Slice:
+		return "list"
+	}
+	if t == bigType {
+		return "int"
+	}
+	return t.String()
+}
+
+// ========================================================
+
+func numberValue(c *NumberNode) Value {
+	switch {
+	case c.IsInt:
+		return bigValue(big.NewInt(c.Int64))
+
+	case c.IsBigInt:
+		return (*BigInt)(c.BigInt)
+
+	case c.IsFloat:
+		return Float(c.Float64)
+	}
+
+	panic("not reached")
+}
+
+// Value of a quote. It's built only once, so all the evaluations
+// return the same object like the constants of the compiled code.
+func (n *QuoteNode) datum() Value {
+	n.once.Do(func() {
+		n.value = datumValue(n.Datum)
+	})
+	return n.value
+}
+
+// Build the value of a quoted node. Literals evaluate to themselves.
+func datumValue(n Node) Value {
+	switch n := n.(type) {
+	case *VarNode:
+		return Symbol(n.Name)
+
+	case *ListNode:
+		var l Value = (*Pair)(nil)
+		if n.Tail != nil {
+			l = datumValue(n.Tail)
+		}
+		for i := len(n.Nodes) - 1; i >= 0; i-- {
+			l = &Pair{Car: datumValue(n.Nodes[i]), Cdr: l}
+		}
+		return l
+
+	case *NumberNode:
+		return numberValue(n)
+
+	case *StringNode:
+		return String(n.Text)
+
+	case *BoolNode:
+		return Bool(n.Value)
+	}
+
+	panic("not reached")
+}
@@ -0,0 +1,393 @@
+package water
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Marks the local variables that have not been defined yet.
+type unboundValue struct{}
+
+func (v unboundValue) String() string {
+	return "<unbound>"
+}
+
+func (v unboundValue) value() {}
+
+var unbound Value = unboundValue{}
+
+// Environment of a call to a compiled function.
+type frame struct {
+	names []string
+	slots []Value
+	outer *frame
+}
+
+type closureValue struct {
+	name  string // name of the first variable the closure was assigned to
+	proto *proto
+	env   *frame // environment where the closure was created
+}
+
+func (v *closureValue) String() string {
+	return fmt.Sprintf("<lambda value with arity %s>", v.proto.arity)
+}
+
+func (v *closureValue) value() {}
+
+func (v *closureValue) procedure() {}
+
+// ========================================================
+
+type callFrame struct {
+	closure *closureValue // nil for the top-level expressions
+	proto   *proto
+	env     *frame
+	pc      int
+	call    Pos // position of the call, for the stack of the errors
+	loops   []loopState
+}
+
+// State to restore when a break exits a loop.
+type loopState struct {
+	sp  int
+	env *frame
+}
+
+// Stack machine that runs the compiled code. The global variables and
+// the builtin functions are shared with the tree-walking interpreter.
+type vm struct {
+	global *state
+	stack  []Value
+	frames []callFrame
+}
+
+func newVM(global *state) *vm {
+	return &vm{global: global}
+}
+
+// Run a compiled top-level expression, returning its value.
+func (m *vm) run(p *proto) (v Value, err error) {
+	m.stack = m.stack[:0]
+	m.frames = append(m.frames[:0], callFrame{proto: p})
+
+	defer m.recover(&err)
+
+	return m.loop(), nil
+}
+
+func (m *vm) recover(errp *error) {
+	if e := recover(); e != nil {
+		if _, ok := e.(runtime.Error); ok {
+			panic(e)
+		}
+
+		err, ok := e.(*RuntimeError)
+		if !ok {
+			err = &RuntimeError{Msg: fmt.Sprint(e)}
+		}
+
+		// Record the active calls, the innermost first
+		for i := len(m.frames) - 1; i >= 0; i-- {
+			f := m.frames[i]
+			if f.closure == nil {
+				continue
+			}
+
+			err.Stack = append(err.Stack, Frame{Name: lambdaName(f.closure.name), Pos: f.call})
+		}
+
+		*errp = err
+	}
+}
+
+// Abort the execution with an error located in the current instruction.
+func (m *vm) errorf(format string, args ...interface{}) {
+	f := &m.frames[len(m.frames)-1]
+	panic(&RuntimeError{
+		Pos: f.proto.pos[f.pc-1],
+		Msg: fmt.Sprintf(format, args...),
+	})
+}
+
+func (m *vm) push(v Value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *vm) pop() Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+func (m *vm) top() Value {
+	return m.stack[len(m.stack)-1]
+}
+
+// Return the environment and the index of a local variable.
+func (m *vm) local(env *frame, addr int) (*frame, int) {
+	for depth := addr >> 16; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env, addr & 0xffff
+}
+
+// Give a name to the closures assigned to variables, to identify
+// them in the errors.
+func nameClosure(v Value, name string) {
+	if c, ok := v.(*closureValue); ok && c.name == "" {
+		c.name = name
+	}
+}
+
+func (m *vm) loop() Value {
+	f := &m.frames[len(m.frames)-1]
+
+	for {
+		ins := f.proto.code[f.pc]
+		f.pc++
+
+		switch ins.op() {
+		case opConst:
+			m.push(f.proto.consts[ins.arg()])
+
+		case opPop:
+			m.pop()
+
+		case opLocal:
+			env, i := m.local(f.env, ins.arg())
+			v := env.slots[i]
+			if v == unbound {
+				m.errorf("variable not defined: %s", env.names[i])
+			}
+			m.push(v)
+
+		case opSetLocal:
+			env, i := m.local(f.env, ins.arg())
+			if env.slots[i] == unbound {
+				m.errorf("variable not defined: %s", env.names[i])
+			}
+			env.slots[i] = m.top()
+
+		case opUnbound:
+			env, i := m.local(f.env, ins.arg())
+			m.push(Bool(env.slots[i] == unbound))
+
+		case opDefineLocal:
+			env, i := m.local(f.env, ins.arg())
+			if env.slots[i] != unbound {
+				m.errorf("variable already defined: %s", env.names[i])
+			}
+			nameClosure(m.top(), env.names[i])
+			env.slots[i] = m.top()
+
+		case opGlobal:
+			name := f.proto.names[ins.arg()]
+			v, ok := m.global.vars[name]
+			if !ok {
+				// Builtin functions can be used as values too
+				b, ok := m.global.funcs[name]
+				if !ok {
+					m.errorf("variable not defined: %s", name)
+				}
+				v = b
+			}
+			m.push(v)
+
+		case opSetGlobal:
+			name := f.proto.names[ins.arg()]
+			if _, ok := m.global.vars[name]; !ok {
+				m.errorf("variable not defined: %s", name)
+			}
+			m.global.vars[name] = m.top()
+
+		case opDefineGlobal:
+			// The global variables can be defined again
+			name := f.proto.names[ins.arg()]
+			nameClosure(m.top(), name)
+			m.global.vars[name] = m.top()
+
+		case opJump:
+			f.pc = ins.arg()
+
+		case opJumpFalse:
+			if !isTrue(m.pop()) {
+				f.pc = ins.arg()
+			}
+
+		case opAnd:
+			if !isTrue(m.top()) {
+				f.pc = ins.arg()
+			} else {
+				m.pop()
+			}
+
+		case opOr:
+			if isTrue(m.top()) {
+				f.pc = ins.arg()
+			} else {
+				m.pop()
+			}
+
+		case opMemv:
+			key := m.top()
+			found := false
+			for l := f.proto.consts[ins.arg()].(*Pair); l != nil; l = l.Cdr.(*Pair) {
+				if eqv(key, l.Car) {
+					found = true
+					break
+				}
+			}
+			m.push(Bool(found))
+
+		case opClosure:
+			m.push(&closureValue{
+				proto: f.proto.protos[ins.arg()],
+				env:   f.env,
+			})
+
+		case opCall, opTailCall:
+			nargs := ins.arg()
+			base := len(m.stack) - nargs - 1
+			callee := m.stack[base]
+			switch c := callee.(type) {
+			case Nil:
+				m.errorf("cannot call an expression without value")
+
+			case *builtinValue:
+				v, err := callBuiltin(c, m.stack[base+1:])
+				if err != nil {
+					m.errorf("%s", err)
+				}
+				m.stack = m.stack[:base]
+				m.push(v)
+
+				// Builtins in tail position return directly to the caller
+				if ins.op() == opTailCall {
+					if f = m.ret(); f == nil {
+						return m.pop()
+					}
+				}
+
+			case *lambdaValue:
+				m.errorf("cannot call a function created by another backend: %s", c)
+
+			case *closureValue:
+				p := c.proto
+				if !p.arity.accepts(nargs) {
+					m.errorf("%s", arityError(lambdaName(c.name), p.arity, nargs))
+				}
+
+				// Build the environment with the arguments. The omitted
+				// optional ones are filled by the function itself
+				env := &frame{
+					names: p.slots,
+					slots: make([]Value, len(p.slots)),
+					outer: c.env,
+				}
+				args := m.stack[base+1:]
+				n := copy(env.slots[:p.params], args)
+				for i := n; i < len(env.slots); i++ {
+					env.slots[i] = unbound
+				}
+				if p.rest {
+					env.slots[p.params] = list(args[n:]...)
+				}
+				m.stack = m.stack[:base]
+
+				call := callFrame{
+					closure: c,
+					proto:   c.proto,
+					env:     env,
+					call:    f.proto.pos[f.pc-1],
+				}
+				if ins.op() == opTailCall {
+					*f = call
+				} else {
+					// The top-level code is in the first frame, unless
+					// it was replaced by a call in tail position
+					depth := len(m.frames)
+					if m.frames[0].closure == nil {
+						depth--
+					}
+					if depth >= m.global.maxDepth {
+						m.errorf("stack overflow")
+					}
+					m.frames = append(m.frames, call)
+					f = &m.frames[len(m.frames)-1]
+				}
+
+			default:
+				m.errorf("cannot call a value that is not a function: %s", formatDatum(callee))
+			}
+
+		case opEnter:
+			let := f.proto.lets[ins.arg()]
+			env := &frame{
+				names: let.names,
+				slots: make([]Value, len(let.names)),
+				outer: f.env,
+			}
+			base := len(m.stack) - let.values
+			for i, v := range m.stack[base:] {
+				nameClosure(v, let.names[i])
+				env.slots[i] = v
+			}
+			for i := let.values; i < len(env.slots); i++ {
+				env.slots[i] = unbound
+			}
+			m.stack = m.stack[:base]
+			f.env = env
+
+		case opLeave:
+			f.env = f.env.outer
+
+		case opLoop:
+			f.loops = append(f.loops, loopState{sp: len(m.stack), env: f.env})
+
+		case opEndLoop:
+			f.loops = f.loops[:len(f.loops)-1]
+
+		case opBreak:
+			v := m.pop()
+			loop := f.loops[len(f.loops)-1]
+			f.loops = f.loops[:len(f.loops)-1]
+			m.stack = m.stack[:loop.sp]
+			f.env = loop.env
+			m.push(v)
+			f.pc = ins.arg()
+
+		case opDotimes:
+			v := m.stack[len(m.stack)-2]
+			count, ok := v.(Int)
+			if !ok {
+				if _, tooLarge := v.(*BigInt); tooLarge {
+					m.errorf("dotimes count is too large")
+				}
+				m.errorf("dotimes count is not an integer")
+			}
+			i := m.top().(Int)
+			if i >= count {
+				f.pc = ins.arg()
+			} else {
+				m.stack[len(m.stack)-1] = i + 1
+				m.push(i)
+			}
+
+		case opReturn:
+			if f = m.ret(); f == nil {
+				return m.pop()
+			}
+		}
+	}
+}
+
+// Return from the current function, leaving its value in the stack.
+// It returns the frame of the caller, or nil if there's none.
+func (m *vm) ret() *callFrame {
+	m.frames = m.frames[:len(m.frames)-1]
+	if len(m.frames) == 0 {
+		return nil
+	}
+	return &m.frames[len(m.frames)-1]
+}